@@ -0,0 +1,129 @@
+package scaffolder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"testing/fstest"
+)
+
+// ArchiveFormat is the format of an archive written by ScaffoldArchive.
+type ArchiveFormat int
+
+const (
+	Tar ArchiveFormat = iota
+	TarGz
+	Zip
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case Tar:
+		return "tar"
+	case TarGz:
+		return "tar.gz"
+	case Zip:
+		return "zip"
+	default:
+		return fmt.Sprintf("ArchiveFormat(%d)", int(f))
+	}
+}
+
+// ScaffoldArchive is like Scaffold but writes the scaffolded files,
+// directories and symlinks to w as an archive in the given format rather than
+// to a destination directory.
+//
+// Modes are preserved. As with Render, paths passed to AfterEach hooks are
+// relative to the root of the archive, and Config.Target() is ".".
+func ScaffoldArchive(source string, w io.Writer, format ArchiveFormat, ctx any, options ...Option) error {
+	dst := &memTarget{files: fstest.MapFS{}}
+	if err := run(context.Background(), osFS{}, source, dst, ".", ctx, options); err != nil {
+		return err
+	}
+	return writeArchive(w, format, dst.files)
+}
+
+func writeArchive(w io.Writer, format ArchiveFormat, files fstest.MapFS) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	switch format {
+	case Tar:
+		return writeTar(w, names, files)
+	case TarGz:
+		gz := gzip.NewWriter(w)
+		if err := writeTar(gz, names, files); err != nil {
+			return err
+		}
+		return gz.Close()
+	case Zip:
+		return writeZip(w, names, files)
+	default:
+		return fmt.Errorf("unsupported archive format %s", format)
+	}
+}
+
+func writeTar(w io.Writer, names []string, files fstest.MapFS) error {
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		file := files[name]
+		hdr := &tar.Header{Name: name, Mode: int64(file.Mode.Perm()), ModTime: file.ModTime}
+		switch {
+		case file.Mode.IsDir():
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		case file.Mode&fs.ModeSymlink != 0:
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = string(file.Data)
+		default:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(file.Data))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write(file.Data); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+func writeZip(w io.Writer, names []string, files fstest.MapFS) error {
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		file := files[name]
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.ModTime}
+		if file.Mode.IsDir() {
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+		}
+		hdr.SetMode(file.Mode)
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+		if !file.Mode.IsDir() {
+			// A symlink's content is its target.
+			if _, err := fw.Write(file.Data); err != nil {
+				return fmt.Errorf("failed to write archive: %w", err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
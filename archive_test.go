@@ -0,0 +1,85 @@
+package scaffolder_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+)
+
+type archiveEntry struct {
+	Mode    fs.FileMode
+	Content string
+}
+
+func archiveTree(t *testing.T) string {
+	t.Helper()
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}/main.go": "package {{ .Name }}",
+		"run.sh":              "#!/bin/sh",
+	})
+	assert.NoError(t, os.Chmod(filepath.Join(src, "run.sh"), 0o755))
+	assert.NoError(t, os.Symlink("run.sh", filepath.Join(src, "start")))
+	return src
+}
+
+var expectedArchive = map[string]archiveEntry{
+	"app/":        {Mode: fs.ModeDir | 0o700},
+	"app/main.go": {Mode: 0o600, Content: "package app"},
+	"run.sh":      {Mode: 0o755, Content: "#!/bin/sh"},
+	"start":       {Mode: fs.ModeSymlink | 0o777, Content: "run.sh"},
+}
+
+func TestScaffoldArchiveZip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := scaffolder.ScaffoldArchive(archiveTree(t), buf, scaffolder.Zip, map[string]any{"Name": "app"})
+	assert.NoError(t, err)
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.NoError(t, err)
+	entries := map[string]archiveEntry{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		assert.NoError(t, err)
+		content, err := io.ReadAll(rc)
+		assert.NoError(t, err)
+		assert.NoError(t, rc.Close())
+		entries[f.Name] = archiveEntry{Mode: f.Mode(), Content: string(content)}
+	}
+	assert.Equal(t, expectedArchive, entries)
+}
+
+func TestScaffoldArchiveTarGz(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := scaffolder.ScaffoldArchive(archiveTree(t), buf, scaffolder.TarGz, map[string]any{"Name": "app"})
+	assert.NoError(t, err)
+
+	gz, err := gzip.NewReader(buf)
+	assert.NoError(t, err)
+	r := tar.NewReader(gz)
+	entries := map[string]archiveEntry{}
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.NoError(t, err)
+		content, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		if hdr.Typeflag == tar.TypeSymlink {
+			content = []byte(hdr.Linkname)
+		}
+		entries[hdr.Name] = archiveEntry{Mode: hdr.FileInfo().Mode(), Content: string(content)}
+	}
+	assert.Equal(t, expectedArchive, entries)
+}
@@ -0,0 +1,62 @@
+package scaffolder
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// commentStyle describes how to write a line comment in a file format.
+type commentStyle struct {
+	prefix string
+	suffix string
+}
+
+var commentStyles = map[string]commentStyle{
+	".go":   {prefix: "// "},
+	".ts":   {prefix: "// "},
+	".tsx":  {prefix: "// "},
+	".js":   {prefix: "// "},
+	".jsx":  {prefix: "// "},
+	".java": {prefix: "// "},
+	".kt":   {prefix: "// "},
+	".rs":   {prefix: "// "},
+	".c":    {prefix: "// "},
+	".h":    {prefix: "// "},
+	".cpp":  {prefix: "// "},
+	".sh":   {prefix: "# "},
+	".bash": {prefix: "# "},
+	".py":   {prefix: "# "},
+	".rb":   {prefix: "# "},
+	".yaml": {prefix: "# "},
+	".yml":  {prefix: "# "},
+	".toml": {prefix: "# "},
+	".html": {prefix: "<!-- ", suffix: " -->"},
+	".htm":  {prefix: "<!-- ", suffix: " -->"},
+	".xml":  {prefix: "<!-- ", suffix: " -->"},
+	".css":  {prefix: "/* ", suffix: " */"},
+	".sql":  {prefix: "-- "},
+}
+
+// Banner prepends comment to each generated file, using the comment syntax
+// appropriate for the file's extension, eg. "// " for .go and "# " for .sh.
+//
+// Each line of comment is commented individually. Files with an unknown
+// extension are left untouched, and the banner is inserted after any leading
+// "#!" line.
+func Banner(comment string) Option {
+	return ContentFilter(func(path, content string) (string, error) {
+		style, ok := commentStyles[strings.ToLower(filepath.Ext(path))]
+		if !ok {
+			return content, nil
+		}
+		banner := &strings.Builder{}
+		for _, line := range strings.Split(strings.TrimSuffix(comment, "\n"), "\n") {
+			banner.WriteString(strings.TrimRight(style.prefix+line+style.suffix, " ") + "\n")
+		}
+		if strings.HasPrefix(content, "#!") {
+			shebang, rest, _ := strings.Cut(content, "\n")
+			return shebang + "\n" + banner.String() + rest, nil
+		}
+		return banner.String() + content, nil
+	})
+}
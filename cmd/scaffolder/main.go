@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"os"
 	"reflect"
@@ -12,38 +15,167 @@ import (
 
 	"github.com/TBD54566975/scaffolder"
 	"github.com/TBD54566975/scaffolder/extensions/javascript"
+	"github.com/TBD54566975/scaffolder/source"
 )
 
 var version string = "dev"
 
 var cli struct {
-	Version  kong.VersionFlag `help:"Show version."`
-	JSON     *os.File         `help:"JSON file containing the context to use."`
-	Template string           `arg:"" help:"Template directory." type:"existingdir"`
-	Dest     string           `arg:"" help:"Destination directory to scaffold." type:"existingdir"`
+	Version   kong.VersionFlag `help:"Show version."`
+	Verbose   bool             `short:"v" help:"Show console output from template.js."`
+	NoJS      bool             `name:"no-js" help:"Disable template.js support."`
+	JSON      *os.File         `help:"JSON file containing the context to use, which may be an object or a list."`
+	ListFuncs bool             `help:"List the functions available to templates and exit."`
+	Lint      bool             `help:"Check that every template in the template directory evaluates, without writing anything."`
+	Feature   []string         `help:"Enable an optional template feature, which templates check for with hasFeature. May be repeated." placeholder:"NAME"`
+	Diff      bool             `help:"Print a unified diff of the changes scaffolding would make to <dest>, without writing anything."`
+	Progress  bool             `help:"Show progress while scaffolding, as a progress bar on a terminal or one line per file otherwise."`
+	Explain   bool             `help:"Report each template entry that is skipped, or copied without evaluation, and why."`
+	Output    string           `short:"o" help:"Write the scaffolded files to a .tar, .tar.gz, .tgz or .zip archive rather than <dest>." type:"path"`
+	SHA256    string           `name:"sha256" help:"Expected SHA-256 checksum of a template archive fetched from a URL. Only valid with a URL."`
+	Template  string           `arg:"" help:"Template directory, or the HTTP(S) URL of a .tar.gz or .zip archive containing one."`
+	Dest      string           `arg:"" optional:"" help:"Destination directory to scaffold." type:"existingdir"`
 }
 
+// errLintFailed is returned by run when --lint has already reported errors.
+var errLintFailed = errors.New("lint failed")
+
 func main() {
 	kctx := kong.Parse(&cli, kong.Vars{"version": version})
-	context := json.RawMessage{}
+	err := run()
+	if errors.Is(err, errLintFailed) {
+		kctx.Exit(1)
+	}
+	kctx.FatalIfErrorf(err)
+}
+
+// run scaffolds according to the parsed command line. It returns errors
+// rather than exiting so that deferred cleanup always runs.
+func run() error {
+	templateDir := cli.Template
+	if source.IsURL(templateDir) {
+		dir, cleanup, err := source.FetchArchive(context.Background(), templateDir, source.WithSHA256(cli.SHA256))
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		templateDir = dir
+	} else if cli.SHA256 != "" {
+		return fmt.Errorf("%s: --sha256 is only supported for templates fetched from a URL", templateDir)
+	} else if info, err := os.Stat(templateDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s: expected an existing template directory or URL", templateDir)
+	}
+	var context any
 	if cli.JSON != nil {
 		if err := json.NewDecoder(cli.JSON).Decode(&context); err != nil {
-			kctx.FatalIfErrorf(err, "failed to decode JSON")
-		}
-	}
-	err := scaffolder.Scaffold(cli.Template, cli.Template, context, scaffolder.Functions(template.FuncMap{
-		"snake":          strcase.ToSnake,
-		"screamingSnake": strcase.ToScreamingSnake,
-		"camel":          strcase.ToCamel,
-		"lowerCamel":     strcase.ToLowerCamel,
-		"kebab":          strcase.ToKebab,
-		"screamingKebab": strcase.ToScreamingKebab,
-		"upper":          strings.ToUpper,
-		"lower":          strings.ToLower,
-		"title":          strings.Title,
-		"typename": func(v any) string {
-			return reflect.Indirect(reflect.ValueOf(v)).Type().Name()
-		},
-	}), scaffolder.Extend(javascript.Extension("template.js")))
-	kctx.FatalIfErrorf(err)
+			return fmt.Errorf("failed to decode JSON: %w", err)
+		}
+	}
+	options := []scaffolder.Option{
+		scaffolder.Functions(template.FuncMap{
+			"snake":          strcase.ToSnake,
+			"screamingSnake": strcase.ToScreamingSnake,
+			"camel":          strcase.ToCamel,
+			"lowerCamel":     strcase.ToLowerCamel,
+			"kebab":          strcase.ToKebab,
+			"screamingKebab": strcase.ToScreamingKebab,
+			"upper":          strings.ToUpper,
+			"lower":          strings.ToLower,
+			"title":          strings.Title,
+			"typename": func(v any) string {
+				return reflect.Indirect(reflect.ValueOf(v)).Type().Name()
+			},
+		}),
+	}
+	if len(cli.Feature) > 0 {
+		options = append(options, scaffolder.Features(cli.Feature...))
+	}
+	if cli.Explain {
+		options = append(options, scaffolder.OnSkip(explain))
+	}
+	if !cli.NoJS {
+		logger := javascript.Discard()
+		if cli.Verbose {
+			logger = javascript.Stderr()
+		}
+		options = append(options, scaffolder.Extend(javascript.Extension("template.js", javascript.WithLogger(logger))))
+	}
+	if cli.ListFuncs {
+		names, err := scaffolder.ListFunctions(templateDir, context, options...)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	if cli.Lint {
+		errs := scaffolder.Lint(templateDir, context, options...)
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if len(errs) > 0 {
+			return errLintFailed
+		}
+		return nil
+	}
+	if cli.Output != "" {
+		if cli.Dest != "" {
+			return errors.New("--output and <dest> are mutually exclusive")
+		}
+		return scaffoldArchive(cli.Output, templateDir, context, options)
+	}
+	if cli.Dest == "" {
+		return errors.New("expected <dest>")
+	}
+	if cli.Diff {
+		diff, err := scaffolder.Diff(templateDir, cli.Dest, context, options...)
+		if err != nil {
+			return err
+		}
+		fmt.Print(diff)
+		return nil
+	}
+	if cli.Progress {
+		p := newProgress(os.Stdout, cli.Dest)
+		defer p.finish()
+		options = append(options, p.options()...)
+	}
+	return scaffolder.Scaffold(templateDir, cli.Dest, context, options...)
+}
+
+// explain reports a skipped entry on stderr.
+func explain(skip scaffolder.Skip) {
+	if skip.Destination != "" {
+		fmt.Fprintf(os.Stderr, "%s: %s (%s)\n", skip.Path, skip.Reason, skip.Destination)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", skip.Path, skip.Reason)
+}
+
+// scaffoldArchive scaffolds templateDir into an archive at output, whose
+// format is determined by its extension.
+func scaffoldArchive(output, templateDir string, ctx any, options []scaffolder.Option) error {
+	var format scaffolder.ArchiveFormat
+	switch {
+	case strings.HasSuffix(output, ".tar"):
+		format = scaffolder.Tar
+	case strings.HasSuffix(output, ".tar.gz"), strings.HasSuffix(output, ".tgz"):
+		format = scaffolder.TarGz
+	case strings.HasSuffix(output, ".zip"):
+		format = scaffolder.Zip
+	default:
+		return fmt.Errorf("%s: unsupported archive type, expected .tar, .tar.gz, .tgz or .zip", output)
+	}
+	w, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := scaffolder.ScaffoldArchive(templateDir, w, format, ctx, options...); err != nil {
+		_ = w.Close()
+		_ = os.Remove(output)
+		return err
+	}
+	return w.Close()
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"github.com/alecthomas/kong"
+
+	"github.com/TBD54566975/scaffolder/scaffoldertest"
+)
+
+// parse parses args into cli, restoring its previous value once t completes.
+func parse(t *testing.T, args ...string) {
+	t.Helper()
+	saved := cli
+	t.Cleanup(func() { cli = saved })
+	parser, err := kong.New(&cli, kong.Vars{"version": version})
+	assert.NoError(t, err)
+	_, err = parser.Parse(args)
+	assert.NoError(t, err)
+}
+
+func TestRunScaffoldsIntoDest(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "file.txt"), []byte("content"), 0o600))
+	dest := t.TempDir()
+	parse(t, "--no-js", src, dest)
+	assert.NoError(t, run())
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "file.txt", Mode: 0o600, Content: "content"},
+	})
+	scaffoldertest.AssertFilesEqual(t, src, []scaffoldertest.File{
+		{Name: "file.txt", Mode: 0o600, Content: "content"},
+	})
+}
+
+func TestRunSHA256RequiresURL(t *testing.T) {
+	src := t.TempDir()
+	parse(t, "--no-js", "--sha256", "0000", src, t.TempDir())
+	err := run()
+	assert.EqualError(t, err, src+": --sha256 is only supported for templates fetched from a URL")
+}
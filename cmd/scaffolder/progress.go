@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/TBD54566975/scaffolder"
+)
+
+const progressWidth = 30
+
+// progress reports the number of entries scaffolded out of the total planned.
+//
+// On a terminal it redraws a single progress bar, otherwise it writes one line
+// per entry.
+type progress struct {
+	w     *os.File
+	tty   bool
+	dest  string
+	total int
+	done  int
+}
+
+func newProgress(w *os.File, dest string) *progress {
+	info, err := w.Stat()
+	tty := err == nil && info.Mode()&os.ModeCharDevice != 0
+	return &progress{w: w, tty: tty, dest: dest}
+}
+
+// options returns the scaffolder options that feed the progress display.
+func (p *progress) options() []scaffolder.Option {
+	return []scaffolder.Option{
+		scaffolder.OnPlan(func(total int) { p.total = total }),
+		scaffolder.AfterEachEntry(p.entry),
+	}
+}
+
+func (p *progress) entry(path string, _ fs.FileInfo, _ scaffolder.EntryKind) error {
+	p.done++
+	// Files added by extensions aren't part of the plan.
+	total := max(p.total, p.done)
+	if !p.tty {
+		if rel, err := filepath.Rel(p.dest, path); err == nil {
+			path = rel
+		}
+		fmt.Fprintf(p.w, "[%d/%d] %s\n", p.done, total, path)
+		return nil
+	}
+	filled := p.done * progressWidth / total
+	fmt.Fprintf(p.w, "\r[%s%s] %d/%d", strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled), p.done, total)
+	return nil
+}
+
+// finish ends the progress bar line.
+func (p *progress) finish() {
+	if p.tty && p.done > 0 {
+		fmt.Fprintln(p.w)
+	}
+}
@@ -0,0 +1,85 @@
+package scaffolder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hexops/gotextdiff"
+	"github.com/hexops/gotextdiff/myers"
+	"github.com/hexops/gotextdiff/span"
+)
+
+// Diff renders the scaffolding files in source using ctx, returning a unified
+// diff of the changes that scaffolding into destination would make to it.
+//
+// Nothing is written. Files that would be created are diffed against
+// /dev/null, and symlinks are diffed by their target. Files in destination
+// that wouldn't be written, eg. due to OverwriteOnly, are ignored, as are file
+// modes.
+//
+// Files are rendered in memory over the existing contents of destination, so
+// that options such as ProtectedRegions and OverwriteUnmodified behave as
+// they would for Scaffold. Paths passed to AfterEach hooks are relative to
+// destination and Config.Target() is ".".
+func Diff(source, destination string, ctx any, options ...Option) (string, error) {
+	dst := newOverlayTarget(destination)
+	if err := run(context.Background(), osFS{}, source, dst, ".", ctx, options); err != nil {
+		return "", err
+	}
+	out := &strings.Builder{}
+	err := fs.WalkDir(dst.mem.files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rendered := string(dst.mem.files[name].Data)
+		path := filepath.Join(destination, filepath.FromSlash(name))
+		var existing []byte
+		if d.Type()&fs.ModeSymlink != 0 {
+			var target string
+			target, err = os.Readlink(path)
+			existing = []byte(target)
+		} else {
+			existing, err = os.ReadFile(path)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			writeNewFileDiff(out, "b/"+name, rendered)
+			return nil
+		} else if err != nil {
+			return &FSError{Op: "read destination file", Path: path, Err: err}
+		}
+		edits := myers.ComputeEdits(span.URIFromPath(name), string(existing), rendered)
+		if len(edits) > 0 {
+			fmt.Fprint(out, gotextdiff.ToUnified("a/"+name, "b/"+name, string(existing), edits))
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// writeNewFileDiff writes the unified diff creating the file name with
+// content.
+func writeNewFileDiff(out *strings.Builder, name, content string) {
+	fmt.Fprintf(out, "--- /dev/null\n+++ %s\n", name)
+	if content == "" {
+		return
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	fmt.Fprintf(out, "@@ -0,0 +1,%d @@\n", len(lines))
+	for _, line := range lines {
+		out.WriteString("+" + line)
+		if !strings.HasSuffix(line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package scaffolder
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"io"
+	"text/template"
+)
+
+// Engine parses and executes templates, such as file contents and path names.
+//
+// The default engine uses text/template. See WithEngine.
+type Engine interface {
+	// Parse parses the template tmpl read from path, which may call funcs.
+	Parse(path, tmpl string, funcs FuncMap) (any, error)
+	// Execute executes a template returned by Parse with ctx, writing the
+	// result to w.
+	Execute(w io.Writer, parsed any, ctx any) error
+}
+
+// WithEngine evaluates all templates, including file contents, path names and
+// symlink targets, with engine rather than text/template.
+//
+// Functions are passed to engine, but it need not support them. HTMLEscape has
+// no effect when a custom engine is used.
+func WithEngine(engine Engine) Option {
+	return func(so *scaffoldOptions) {
+		if engine == nil {
+			so.errs = append(so.errs, errors.New("WithEngine requires an engine"))
+			return
+		}
+		so.engine = engine
+	}
+}
+
+// textEngine is the default Engine, using text/template.
+type textEngine struct{}
+
+var _ Engine = textEngine{}
+
+func (textEngine) Parse(path, tmpl string, funcs FuncMap) (any, error) {
+	return template.New(path).Funcs(funcs).Parse(tmpl)
+}
+
+func (textEngine) Execute(w io.Writer, parsed any, ctx any) error {
+	return parsed.(*template.Template).Execute(w, ctx)
+}
+
+// htmlEngine is the Engine used for HTML files by HTMLEscape, using
+// html/template.
+type htmlEngine struct{}
+
+var _ Engine = htmlEngine{}
+
+func (htmlEngine) Parse(path, tmpl string, funcs FuncMap) (any, error) {
+	return htmltemplate.New(path).Funcs(htmltemplate.FuncMap(funcs)).Parse(tmpl)
+}
+
+func (htmlEngine) Execute(w io.Writer, parsed any, ctx any) error {
+	return parsed.(*htmltemplate.Template).Execute(w, ctx)
+}
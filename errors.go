@@ -0,0 +1,64 @@
+package scaffolder
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrFileTooLarge is returned when the rendered content of a file exceeds the
+// limit set by MaxFileSize.
+var ErrFileTooLarge = errors.New("rendered file exceeds maximum size")
+
+// ErrDestNotEmpty is returned by RequireEmptyDest when the destination already
+// contains files.
+var ErrDestNotEmpty = errors.New("destination is not empty")
+
+// TemplateError is returned when a template fails to parse or execute.
+type TemplateError struct {
+	// Path of the file containing the template.
+	Path string
+	// Line within the template, or 0 if unknown.
+	Line int
+	Err  error
+}
+
+func (e *TemplateError) Error() string { return e.Err.Error() }
+func (e *TemplateError) Unwrap() error { return e.Err }
+
+// FSError is returned when a filesystem operation fails.
+type FSError struct {
+	// Op is the operation that failed, eg. "read file".
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *FSError) Error() string { return fmt.Sprintf("failed to %s: %s", e.Op, e.Err) }
+func (e *FSError) Unwrap() error { return e.Err }
+
+// ExcludeError is returned when an exclude pattern is invalid.
+type ExcludeError struct {
+	Pattern string
+	Err     error
+}
+
+func (e *ExcludeError) Error() string {
+	return fmt.Sprintf("invalid exclude pattern %q: %s", e.Pattern, e.Err)
+}
+func (e *ExcludeError) Unwrap() error { return e.Err }
+
+// templateErrorLine extracts the line number from an error returned by
+// text/template or html/template for the template named path.
+func templateErrorLine(path string, err error) int {
+	msg := err.Error()
+	for _, prefix := range []string{"template: " + path + ":", "html/template:" + path + ":"} {
+		if rest, ok := strings.CutPrefix(msg, prefix); ok {
+			digits, _, _ := strings.Cut(rest, ":")
+			line, _ := strconv.Atoi(digits)
+			return line
+		}
+	}
+	return 0
+}
@@ -1,11 +1,16 @@
 package javascript
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"strings"
+	"text/template"
 
 	"github.com/dop251/goja"
 
@@ -29,29 +34,55 @@ func (o *config) makeLogFunc(prefix string) func(args ...any) {
 type Option func(*config)
 
 // WithLogger sets the logger to use for console.log, console.debug, console.error and console.warn.
+//
+// By default console output is discarded.
 func WithLogger(logger func(args ...any)) Option {
 	return func(o *config) { o.logger = logger }
 }
 
+// Discard is a logger for WithLogger that discards all console output.
+func Discard() func(args ...any) {
+	return func(args ...any) {}
+}
+
+// Stderr is a logger for WithLogger that writes console output to os.Stderr.
+func Stderr() func(args ...any) {
+	return func(args ...any) { fmt.Fprintln(os.Stderr, args...) }
+}
+
 // Extension is a scaffolder extension that allows the use of end-user-provided
 // JavaScript code to write template functions.
 //
 // The extension will execute the JS file scriptPath in the source directory
-// if present. If you wish to include a file named scriptPath in the generated
+// if present, and is otherwise inactive. If you wish to include a file named scriptPath in the generated
 // output, you can name it scriptPath.tmpl.
 //
 // A global variable named context will be available in the JS VM. It will
 // contain the scaffolder.Config.Context value.
 //
-// Existing template functions will also be available in the JS VM.
+// Existing template functions will also be available in the JS VM, along with
+// renderPartial(name, ctx), which evaluates the file name, relative to the
+// source directory, as a Go template with ctx and returns the result. Partials
+// have access to the same functions as other templates, including those
+// defined in JS, except for those that only apply to a scaffolded entry, such
+// as push and include. Partials are usually excluded from the output with
+// scaffolder.Exclude.
 func Extension(scriptPath string, options ...Option) scaffolder.Extension {
 	conf := &config{
-		logger: func(args ...any) { fmt.Fprintln(os.Stderr, args...) },
+		logger: Discard(),
 	}
 	for _, option := range options {
 		option(conf)
 	}
 	return scaffolder.ExtensionFunc(func(mutableConfig *scaffolder.Config) error {
+		script, err := os.ReadFile(filepath.Join(mutableConfig.Source(), scriptPath))
+		if errors.Is(err, fs.ErrNotExist) {
+			// No script, so the extension is inactive.
+			return nil
+		} else if err != nil {
+			return err
+		}
+
 		// Exclude the script from the output.
 		mutableConfig.Exclude = append(mutableConfig.Exclude, "^"+regexp.QuoteMeta(scriptPath)+"$")
 
@@ -65,14 +96,15 @@ func Extension(scriptPath string, options ...Option) scaffolder.Extension {
 		if err := initConsole(vm, conf); err != nil {
 			return err
 		}
+		if err := vm.Set("renderPartial", partialFunc(mutableConfig)); err != nil {
+			return err
+		}
 		if err := vm.Set("context", mutableConfig.Context); err != nil {
 			return err
 		}
 		scriptPath := filepath.Join(mutableConfig.Source(), scriptPath)
-		if script, err := os.ReadFile(scriptPath); err == nil {
-			if _, err := vm.RunScript(scriptPath, string(script)); err != nil {
-				return fmt.Errorf("failed to run %s: %w", scriptPath, err)
-			}
+		if _, err := vm.RunScript(scriptPath, string(script)); err != nil {
+			return fmt.Errorf("failed to run %s: %w", scriptPath, err)
 		}
 
 		global := vm.GlobalObject()
@@ -101,18 +133,81 @@ func Extension(scriptPath string, options ...Option) scaffolder.Extension {
 			if !ok {
 				continue
 			}
-			mutableConfig.Funcs[key] = func(args ...any) (any, error) {
-				vmArgs := make([]goja.Value, len(args))
-				for i, arg := range args {
-					vmArgs[i] = vm.ToValue(arg)
-				}
-				return fn(global, vmArgs...)
-			}
+			mutableConfig.Funcs[key] = wrapFunc(vm, global, key, fn, attr.ToObject(vm).Get("length").ToInteger())
 		}
 		return nil
 	})
 }
 
+// wrapFunc wraps the JS function fn as a Go template function.
+//
+// As JS functions may be variadic, calls with more than arity arguments are
+// allowed, but calls with fewer are an error. A JS function returning
+// undefined renders as the empty string. Strings, numbers and booleans are
+// returned as Go values, so they can be passed to other functions, while
+// other values such as arrays and objects render as JS converts them to
+// strings, eg. "a,b" for ["a", "b"].
+func wrapFunc(vm *goja.Runtime, this goja.Value, name string, fn goja.Callable, arity int64) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		if int64(len(args)) < arity {
+			return nil, fmt.Errorf("%s: expected at least %d arguments but got %d", name, arity, len(args))
+		}
+		vmArgs := make([]goja.Value, len(args))
+		for i, arg := range args {
+			vmArgs[i] = vm.ToValue(arg)
+		}
+		result, err := fn(this, vmArgs...)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if goja.IsUndefined(result) {
+			return "", nil
+		}
+		switch value := result.Export().(type) {
+		case string, int64, float64, bool:
+			return value, nil
+		}
+		return result, nil
+	}
+}
+
+// maxPartialDepth limits recursion between partials and JS functions.
+const maxPartialDepth = 32
+
+// partialFunc returns the renderPartial function for the JS VM.
+func partialFunc(cfg *scaffolder.Config) func(name string, ctx any) (string, error) {
+	depth := 0
+	return func(name string, ctx any) (string, error) {
+		if !filepath.IsLocal(name) {
+			return "", fmt.Errorf("renderPartial: %q is outside the source directory", name)
+		}
+		if depth >= maxPartialDepth {
+			return "", fmt.Errorf("renderPartial: %s: maximum depth of %d exceeded", name, maxPartialDepth)
+		}
+		depth++
+		defer func() { depth-- }()
+		path := filepath.Join(cfg.Source(), name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("renderPartial: %w", err)
+		}
+		// Functions are looked up when the partial is rendered, so that those
+		// defined in JS are available.
+		// Builtins reserved for scaffolded entries are unavailable to partials.
+		funcs := maps.Clone(cfg.Funcs)
+		maps.DeleteFunc(funcs, func(name string, _ any) bool { return scaffolder.IsReservedFunc(name) })
+		tmpl, err := template.New(path).Funcs(funcs).Parse(string(data))
+		if err != nil {
+			return "", fmt.Errorf("renderPartial: %w", err)
+		}
+		out := &strings.Builder{}
+		if err := tmpl.Execute(out, ctx); err != nil {
+			return "", fmt.Errorf("renderPartial: %w", err)
+		}
+		return out.String(), nil
+	}
+}
+
 func initConsole(vm *goja.Runtime, conf *config) error {
 	console := vm.NewObject()
 	if err := console.Set("log", conf.makeLogFunc("log:")); err != nil {
@@ -1,6 +1,10 @@
 package javascript
 
 import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alecthomas/assert/v2"
@@ -32,3 +36,120 @@ func TestExtension(t *testing.T) {
 		{Name: "hello.txt", Mode: 0600, Content: "Hello Alice"},
 	})
 }
+
+func TestJSFunctionArity(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`function greet(greeting, name) { return greeting + " " + name; }`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "hello.txt"), []byte(`{{ greet "Hello" }}`), 0600))
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Extend(Extension("template.js")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "greet: expected at least 2 arguments but got 1")
+}
+
+func TestJSFunctionUndefined(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`function nothing() {}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "nothing.txt"), []byte(`before{{ nothing }}after`), 0600))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Extend(Extension("template.js")))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "nothing.txt", Mode: 0600, Content: "beforeafter"},
+	})
+}
+
+func TestJSFunctionResults(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`
+function list() { return ["a", "b"]; }
+function name() { return "alice"; }
+function none() { return null; }
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "out.txt"), []byte(`{{ list }} {{ name | upper }} {{ none }}`), 0600))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Extend(Extension("template.js")),
+		scaffolder.Functions(scaffolder.FuncMap{"upper": strings.ToUpper}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "out.txt", Mode: 0600, Content: "a,b ALICE null"},
+	})
+}
+
+func TestRenderPartial(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "partials"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "partials", "header"), []byte(`# {{ .title | shout }}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`
+function shout(s) { return s.toUpperCase(); }
+function header(name) { return renderPartial("partials/header", {title: name}); }
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "README.md"), []byte(`{{ header .Name }}`), 0600))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, Context{Name: "Alice"}, scaffolder.Exclude("^partials"), scaffolder.Extend(Extension("template.js")))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0600, Content: "# ALICE"},
+	})
+}
+
+func TestRenderPartialEntryFuncs(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "partials"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "partials", "header"), []byte(`{{ push "x" . }}`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`
+function header() { return renderPartial("partials/header", {}); }
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "README.md"), []byte(`{{ header }}`), 0600))
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Exclude("^partials"), scaffolder.Extend(Extension("template.js")))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `function "push" not defined`)
+}
+
+func TestSliceContext(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`
+function names() { return context.map(function (c) { return c.name; }).join(","); }
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "{{ range . }}{{ push .Name . }}{{ end }}"), []byte(`{{ .Name }} of {{ names }}`), 0600))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, []Context{{Name: "api"}, {Name: "worker"}}, scaffolder.Extend(Extension("template.js")))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "api", Mode: 0600, Content: "api of api,worker"},
+		{Name: "worker", Mode: 0600, Content: "worker of api,worker"},
+	})
+}
+
+func TestDiscardLogger(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "template.js"), []byte(`console.log("noisy"); console.error("noisy");`), 0600))
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Extend(Extension("template.js", WithLogger(Discard()))))
+	os.Stderr = stderr
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	output, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "", string(output))
+}
+
+func TestExtensionWithoutScript(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "hello.txt"), []byte(`{{ "hello" | toJson }}`), 0600))
+	without, err := scaffolder.ListFunctions(src, nil)
+	assert.NoError(t, err)
+	with, err := scaffolder.ListFunctions(src, nil, scaffolder.Extend(Extension("template.js")))
+	assert.NoError(t, err)
+	assert.Equal(t, without, with)
+
+	dest := t.TempDir()
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.Extend(Extension("template.js")))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "hello.txt", Mode: 0600, Content: `"hello"`},
+	})
+}
@@ -0,0 +1,241 @@
+// Package mustache is a scaffolder extension that renders files as mustache
+// templates, easing migration from cookiecutter-style templates.
+package mustache
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+
+	"github.com/TBD54566975/scaffolder"
+)
+
+// Suffix is the file name suffix of mustache templates.
+const Suffix = ".mustache"
+
+// Extension is a scaffolder extension that renders the content of files whose
+// names end with ".mustache" as mustache templates, removing the suffix from
+// the destination name.
+//
+// Other files are evaluated as Go templates as usual, so both kinds can
+// coexist in the same tree. Path names, including those of mustache files,
+// are always Go templates, eg. "{{ .cookiecutter.name }}.md.mustache".
+func Extension() scaffolder.Extension {
+	return scaffolder.ExtensionFunc(func(mutableConfig *scaffolder.Config) error {
+		mutableConfig.AddRenderer(Suffix, Render)
+		return nil
+	})
+}
+
+// Render evaluates the mustache template tmpl, read from path, using ctx.
+//
+// Variables, unescaped variables, sections, inverted sections and comments
+// are supported, with values looked up in maps with string keys and exported
+// struct fields. Partials, lambdas and custom delimiters are not supported.
+func Render(path, tmpl string, ctx any) (string, error) {
+	nodes, err := parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	out := &strings.Builder{}
+	render(out, nodes, []any{ctx})
+	return out.String(), nil
+}
+
+type node struct {
+	// kind is 0 for text, 'v' for an escaped variable, '&' for an unescaped
+	// variable, '#' for a section and '^' for an inverted section.
+	kind     byte
+	text     string
+	children []*node
+}
+
+// parse parses tmpl into a tree of nodes.
+func parse(tmpl string) ([]*node, error) {
+	root := &node{}
+	stack := []*node{root}
+	pos := 0
+	for {
+		top := stack[len(stack)-1]
+		i := strings.Index(tmpl[pos:], "{{")
+		if i < 0 {
+			if pos < len(tmpl) {
+				top.children = append(top.children, &node{text: tmpl[pos:]})
+			}
+			break
+		}
+		i += pos
+		start := i + 2
+		closing := "}}"
+		if strings.HasPrefix(tmpl[start:], "{") {
+			closing = "}}}"
+		}
+		j := strings.Index(tmpl[start:], closing)
+		if j < 0 {
+			return nil, fmt.Errorf("line %d: unclosed tag", line(tmpl, i))
+		}
+		tag := tmpl[start : start+j]
+		end := start + j + len(closing)
+
+		kind := byte('v')
+		switch {
+		case closing == "}}}":
+			kind, tag = '&', tag[1:]
+		case tag != "" && strings.IndexByte("#^/!&>=", tag[0]) >= 0:
+			kind, tag = tag[0], tag[1:]
+		}
+		name := strings.TrimSpace(tag)
+
+		text := tmpl[pos:i]
+		if strings.IndexByte("#^/!", kind) >= 0 {
+			// A standalone tag is removed along with the line it occupies.
+			lineStart := strings.LastIndexByte(tmpl[:i], '\n') + 1
+			lineEnd := len(tmpl)
+			if k := strings.IndexByte(tmpl[end:], '\n'); k >= 0 {
+				lineEnd = end + k + 1
+			}
+			if isBlank(tmpl[lineStart:i]) && isBlank(tmpl[end:lineEnd]) {
+				text = tmpl[pos:lineStart]
+				end = lineEnd
+			}
+		}
+		if text != "" {
+			top.children = append(top.children, &node{text: text})
+		}
+
+		switch kind {
+		case '!':
+		case '>', '=':
+			return nil, fmt.Errorf("line %d: %q tags are not supported", line(tmpl, i), kind)
+		case '#', '^':
+			section := &node{kind: kind, text: name}
+			top.children = append(top.children, section)
+			stack = append(stack, section)
+		case '/':
+			if len(stack) == 1 || top.text != name {
+				return nil, fmt.Errorf("line %d: unexpected closing tag %q", line(tmpl, i), name)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			top.children = append(top.children, &node{kind: kind, text: name})
+		}
+		pos = end
+	}
+	if len(stack) > 1 {
+		return nil, fmt.Errorf("unclosed section %q", stack[len(stack)-1].text)
+	}
+	return root.children, nil
+}
+
+func render(out *strings.Builder, nodes []*node, stack []any) {
+	for _, n := range nodes {
+		switch n.kind {
+		case 0:
+			out.WriteString(n.text)
+		case 'v', '&':
+			value := resolve(stack, n.text)
+			if value == nil {
+				continue
+			}
+			s := fmt.Sprint(value)
+			if n.kind == 'v' {
+				s = html.EscapeString(s)
+			}
+			out.WriteString(s)
+		case '#':
+			value := resolve(stack, n.text)
+			if falsy(value) {
+				continue
+			}
+			v := reflect.ValueOf(value)
+			if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+				for i := range v.Len() {
+					render(out, n.children, append(stack, v.Index(i).Interface()))
+				}
+				continue
+			}
+			render(out, n.children, append(stack, value))
+		case '^':
+			if falsy(resolve(stack, n.text)) {
+				render(out, n.children, stack)
+			}
+		}
+	}
+}
+
+// resolve looks up the dotted name in the context stack, returning nil if it
+// is not found.
+//
+// The first element of the name is looked up in each context from the
+// innermost outwards, and the remaining elements within the value found.
+func resolve(stack []any, name string) any {
+	if name == "." {
+		return stack[len(stack)-1]
+	}
+	keys := strings.Split(name, ".")
+	var value any
+	found := false
+	for i := len(stack) - 1; i >= 0 && !found; i-- {
+		value, found = field(stack[i], keys[0])
+	}
+	for _, key := range keys[1:] {
+		if !found {
+			break
+		}
+		value, found = field(value, key)
+	}
+	if !found {
+		return nil
+	}
+	return value
+}
+
+// field returns the value of key in the map with string keys or struct v.
+func field(v any, key string) (any, bool) {
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	switch value.Kind() {
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		value = value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+	case reflect.Struct:
+		f, ok := value.Type().FieldByName(key)
+		if !ok || !f.IsExported() {
+			return nil, false
+		}
+		value = value.FieldByIndex(f.Index)
+	default:
+		return nil, false
+	}
+	if !value.IsValid() {
+		return nil, false
+	}
+	return value.Interface(), true
+}
+
+// falsy reports whether value hides a section: nil, false, the empty string
+// or an empty list.
+func falsy(value any) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return true
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.String, reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+func isBlank(s string) bool { return strings.TrimSpace(s) == "" }
+
+// line returns the 1-based line number of offset in s.
+func line(s string, offset int) int { return strings.Count(s[:offset], "\n") + 1 }
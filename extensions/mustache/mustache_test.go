@@ -0,0 +1,78 @@
+package mustache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+	"github.com/TBD54566975/scaffolder/scaffoldertest"
+)
+
+func TestExtension(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "README.md.mustache"), []byte(`# {{cookiecutter.name}}
+
+{{#cookiecutter.authors}}
+- {{name}} <{{email}}>
+{{/cookiecutter.authors}}
+{{^cookiecutter.license}}
+Unlicensed.
+{{/cookiecutter.license}}
+{{! This is a comment. }}
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "{{ .cookiecutter.name }}.txt"), []byte(`{{ .cookiecutter.name }}`), 0600))
+	dest := t.TempDir()
+	ctx := map[string]any{
+		"cookiecutter": map[string]any{
+			"name": "demo",
+			"authors": []map[string]any{
+				{"name": "Alice", "email": "alice@example.com"},
+				{"name": "Bob", "email": "bob@example.com"},
+			},
+		},
+	}
+	err := scaffolder.Scaffold(src, dest, ctx, scaffolder.Extend(Extension()))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0600, Content: `# demo
+
+- Alice <alice@example.com>
+- Bob <bob@example.com>
+Unlicensed.
+`},
+		{Name: "demo.txt", Mode: 0600, Content: "demo"},
+	})
+}
+
+func TestRender(t *testing.T) {
+	type person struct{ Name string }
+	ctx := map[string]any{"HTML": "<b>", "Person": person{Name: "Alice"}, "Tags": []string{"a", "b"}}
+	for _, test := range []struct {
+		tmpl, expected string
+	}{
+		{`{{HTML}}`, "&lt;b&gt;"},
+		{`{{{HTML}}}`, "<b>"},
+		{`{{& HTML}}`, "<b>"},
+		{`{{Person.Name}}`, "Alice"},
+		{`{{#Person}}{{Name}} {{HTML}}{{/Person}}`, "Alice &lt;b&gt;"},
+		{`{{#Tags}}[{{.}}]{{/Tags}}`, "[a][b]"},
+		{`{{missing}}`, ""},
+		{`{{^missing}}none{{/missing}}`, "none"},
+	} {
+		out, err := Render("test", test.tmpl, ctx)
+		assert.NoError(t, err, test.tmpl)
+		assert.Equal(t, test.expected, out, test.tmpl)
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	_, err := Render("test", "{{#a}}\n{{/b}}", nil)
+	assert.EqualError(t, err, `test: line 2: unexpected closing tag "b"`)
+	_, err = Render("test", "{{#a}}", nil)
+	assert.EqualError(t, err, `test: unclosed section "a"`)
+	_, err = Render("test", "{{> partial}}", nil)
+	assert.EqualError(t, err, `test: line 1: '>' tags are not supported`)
+}
@@ -0,0 +1,239 @@
+package scaffolder
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// source is the template tree being scaffolded from.
+//
+// Paths are OS paths rooted at Config.Source().
+type source interface {
+	ReadDir(path string) ([]fs.DirEntry, error)
+	ReadFile(path string) ([]byte, error)
+	// Stat follows symlinks.
+	Stat(path string) (fs.FileInfo, error)
+	Readlink(path string) (string, error)
+	// RealPath returns the canonical path of path with all symlinks resolved.
+	RealPath(path string) (string, error)
+}
+
+// target is the tree being scaffolded into.
+//
+// Paths are OS paths rooted at Config.Target().
+type target interface {
+	MkdirAll(path string, perm os.FileMode) error
+	ReadFile(path string) ([]byte, error)
+	ReadDir(path string) ([]fs.DirEntry, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	Chmod(path string, mode os.FileMode) error
+	Chtimes(path string, atime, mtime time.Time) error
+	// Lchown does not follow symlinks.
+	Lchown(path string, uid, gid int) error
+	Symlink(oldname, newname string) error
+	Remove(path string) error
+	// Stat follows symlinks.
+	Stat(path string) (fs.FileInfo, error)
+	Lstat(path string) (fs.FileInfo, error)
+}
+
+// osFS is a source and target backed by the local filesystem.
+type osFS struct{}
+
+var _ source = osFS{}
+var _ target = osFS{}
+
+func (osFS) ReadDir(path string) ([]fs.DirEntry, error)   { return os.ReadDir(path) }
+func (osFS) ReadFile(path string) ([]byte, error)         { return os.ReadFile(path) }
+func (osFS) Stat(path string) (fs.FileInfo, error)        { return os.Stat(path) }
+func (osFS) Lstat(path string) (fs.FileInfo, error)       { return os.Lstat(path) }
+func (osFS) Readlink(path string) (string, error)         { return os.Readlink(path) }
+func (osFS) RealPath(path string) (string, error)         { return filepath.EvalSymlinks(path) }
+func (osFS) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (osFS) Chmod(path string, mode os.FileMode) error    { return os.Chmod(path, mode) }
+func (osFS) Lchown(path string, uid, gid int) error       { return os.Lchown(path, uid, gid) }
+func (osFS) Chtimes(path string, atime, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
+func (osFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, newname) }
+func (osFS) Remove(path string) error              { return os.Remove(path) }
+func (osFS) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+// fsSource is a source backed by an fs.FS.
+//
+// Symlinks are only supported if the fs.FS implements ReadLink.
+type fsSource struct {
+	fsys fs.FS
+}
+
+var _ source = fsSource{}
+
+func (f fsSource) name(path string) string { return filepath.ToSlash(filepath.Clean(path)) }
+
+func (f fsSource) ReadDir(path string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, f.name(path))
+}
+func (f fsSource) ReadFile(path string) ([]byte, error)  { return fs.ReadFile(f.fsys, f.name(path)) }
+func (f fsSource) Stat(path string) (fs.FileInfo, error) { return fs.Stat(f.fsys, f.name(path)) }
+func (f fsSource) RealPath(path string) (string, error)  { return f.name(path), nil }
+
+func (f fsSource) Readlink(path string) (string, error) {
+	if rl, ok := f.fsys.(interface {
+		ReadLink(name string) (string, error)
+	}); ok {
+		return rl.ReadLink(f.name(path))
+	}
+	return "", &fs.PathError{Op: "readlink", Path: path, Err: fmt.Errorf("symlinks are not supported by %T", f.fsys)}
+}
+
+// memTarget is an in-memory target.
+//
+// Symlinks are stored as entries with fs.ModeSymlink whose content is the
+// link target.
+type memTarget struct {
+	files fstest.MapFS
+}
+
+var _ target = (*memTarget)(nil)
+
+func (m *memTarget) name(p string) string { return filepath.ToSlash(filepath.Clean(p)) }
+
+func (m *memTarget) MkdirAll(p string, perm os.FileMode) error {
+	name := m.name(p)
+	if name == "." || path.Dir(name) == name {
+		// The current directory or a filesystem root.
+		return nil
+	}
+	if err := m.MkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	if f, ok := m.files[name]; ok {
+		if !f.Mode.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	m.files[name] = &fstest.MapFile{Mode: fs.ModeDir | perm, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memTarget) ReadFile(p string) ([]byte, error) {
+	f, ok := m.files[m.name(p)]
+	if !ok || !f.Mode.IsRegular() {
+		return nil, &fs.PathError{Op: "read", Path: p, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(f.Data), nil
+}
+
+func (m *memTarget) ReadDir(p string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(m.files, m.name(p))
+}
+
+func (m *memTarget) WriteFile(p string, data []byte, perm os.FileMode) error {
+	name := m.name(p)
+	if f, ok := m.files[name]; ok {
+		if !f.Mode.IsRegular() {
+			return &fs.PathError{Op: "open", Path: p, Err: fmt.Errorf("not a regular file")}
+		}
+		// Like os.WriteFile, the mode of an existing file is unchanged.
+		perm = f.Mode
+	}
+	m.files[name] = &fstest.MapFile{Data: bytes.Clone(data), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memTarget) Chmod(p string, mode os.FileMode) error {
+	f, ok := m.files[m.name(p)]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: p, Err: fs.ErrNotExist}
+	}
+	f.Mode = f.Mode&^os.ModePerm | mode&os.ModePerm
+	return nil
+}
+
+// Chtimes sets the modification time of p, as access times are not recorded.
+func (m *memTarget) Chtimes(p string, atime, mtime time.Time) error {
+	f, ok := m.files[m.name(p)]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: p, Err: fs.ErrNotExist}
+	}
+	f.ModTime = mtime
+	return nil
+}
+
+// Lchown only checks that p exists, as ownership is not recorded.
+func (m *memTarget) Lchown(p string, uid, gid int) error {
+	if _, ok := m.files[m.name(p)]; !ok {
+		return &fs.PathError{Op: "lchown", Path: p, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+func (m *memTarget) Symlink(oldname, newname string) error {
+	name := m.name(newname)
+	if _, ok := m.files[name]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	m.files[name] = &fstest.MapFile{Data: []byte(oldname), Mode: fs.ModeSymlink | 0o777, ModTime: time.Now()}
+	return nil
+}
+
+func (m *memTarget) Remove(p string) error {
+	name := m.name(p)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: p, Err: fs.ErrNotExist}
+	}
+	prefix := name + "/"
+	for key := range m.files {
+		if strings.HasPrefix(key, prefix) {
+			return &fs.PathError{Op: "remove", Path: p, Err: fmt.Errorf("directory not empty")}
+		}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memTarget) Lstat(p string) (fs.FileInfo, error) {
+	name := m.name(p)
+	f, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "lstat", Path: p, Err: fs.ErrNotExist}
+	}
+	return memFileInfo{name: path.Base(name), file: f}, nil
+}
+
+func (m *memTarget) Stat(p string) (fs.FileInfo, error) {
+	name := m.name(p)
+	for range 255 {
+		f, ok := m.files[name]
+		if !ok {
+			return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+		}
+		if f.Mode&fs.ModeSymlink == 0 {
+			return memFileInfo{name: path.Base(name), file: f}, nil
+		}
+		name = path.Join(path.Dir(name), string(f.Data))
+	}
+	return nil, &fs.PathError{Op: "stat", Path: p, Err: fmt.Errorf("too many levels of symbolic links")}
+}
+
+type memFileInfo struct {
+	name string
+	file *fstest.MapFile
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return int64(len(i.file.Data)) }
+func (i memFileInfo) Mode() fs.FileMode  { return i.file.Mode }
+func (i memFileInfo) ModTime() time.Time { return i.file.ModTime }
+func (i memFileInfo) IsDir() bool        { return i.file.Mode.IsDir() }
+func (i memFileInfo) Sys() any           { return i.file.Sys }
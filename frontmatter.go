@@ -0,0 +1,67 @@
+package scaffolder
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const frontMatterDelimiter = "---\n"
+
+// splitFrontMatter splits a leading YAML front matter block delimited by "---"
+// lines from the body of tmpl.
+//
+// If tmpl has no front matter, the returned map is nil.
+func splitFrontMatter(tmpl string) (map[string]any, string, error) {
+	if !strings.HasPrefix(tmpl, frontMatterDelimiter) {
+		return nil, tmpl, nil
+	}
+	rest := tmpl[len(frontMatterDelimiter):]
+	var header, body string
+	if strings.HasPrefix(rest, frontMatterDelimiter) {
+		body = rest[len(frontMatterDelimiter):]
+	} else {
+		end := strings.Index(rest, "\n"+frontMatterDelimiter)
+		if end == -1 {
+			return nil, "", fmt.Errorf("unterminated front matter")
+		}
+		header = rest[:end+1]
+		body = rest[end+1+len(frontMatterDelimiter):]
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal([]byte(header), &values); err != nil {
+		return nil, "", fmt.Errorf("failed to parse front matter: %w", err)
+	}
+	return values, body, nil
+}
+
+// mergeContext returns a new map containing the fields of ctx overlaid with
+// values.
+//
+// ctx may be nil, a map with string keys, or a struct (or pointer to one), in
+// which case its exported fields are used.
+func mergeContext(ctx any, values map[string]any) (map[string]any, error) {
+	merged := map[string]any{}
+	v := reflect.Indirect(reflect.ValueOf(ctx))
+	switch {
+	case !v.IsValid():
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		for iter := v.MapRange(); iter.Next(); {
+			merged[iter.Key().String()] = iter.Value().Interface()
+		}
+	case v.Kind() == reflect.Struct:
+		for i := range v.NumField() {
+			if field := v.Type().Field(i); field.IsExported() {
+				merged[field.Name] = v.Field(i).Interface()
+			}
+		}
+	default:
+		return nil, fmt.Errorf("can't merge front matter into context of type %T", ctx)
+	}
+	for k, val := range values {
+		merged[k] = val
+	}
+	return merged, nil
+}
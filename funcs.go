@@ -0,0 +1,814 @@
+package scaffolder
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/iancoleman/strcase"
+	"gopkg.in/yaml.v3"
+)
+
+var caseStyles = map[string]func(string) string{
+	"snake":          strcase.ToSnake,
+	"screamingSnake": strcase.ToScreamingSnake,
+	"camel":          strcase.ToCamel,
+	"lowerCamel":     strcase.ToLowerCamel,
+	"kebab":          strcase.ToKebab,
+	"screamingKebab": strcase.ToScreamingKebab,
+	"upper":          strings.ToUpper,
+	"lower":          strings.ToLower,
+}
+
+// defaultFuncs returns the functions available to all scaffolding templates.
+func defaultFuncs() FuncMap {
+	return FuncMap{
+		"b64enc": b64enc,
+		"b64dec": b64dec,
+
+		"sha256":    sha256Sum,
+		"md5":       md5Sum,
+		"shortHash": shortHash,
+
+		"toJson":       toJSON,
+		"toJsonPretty": toJSONPretty,
+		"fromJson":     fromJSON,
+
+		"toYaml":   toYAML,
+		"fromYaml": fromYAML,
+
+		"indent":      indent,
+		"wrap":        wrap,
+		"wrapComment": wrapComment,
+
+		"goString":   strconv.Quote,
+		"shellQuote": shellQuote,
+		"jsonString": jsonString,
+		"regexQuote": regexp.QuoteMeta,
+
+		"lookup": lookup,
+
+		"first":     first,
+		"last":      last,
+		"uniq":      uniq,
+		"sortAlpha": sortAlpha,
+		"reverse":   reverse,
+		"join":      join,
+		"isLast":    isLast,
+		"sep":       sep,
+
+		"comma": comma,
+		"fixed": fixed,
+
+		"toInt":    toInt,
+		"toFloat":  toFloat,
+		"toBool":   toBool,
+		"toString": toString,
+
+		"ternary": ternary,
+		"default": defaultValue,
+
+		"sqlIdent":    sqlIdent,
+		"graphqlName": graphqlName,
+		"initials":    initials,
+
+		"relpath":    relpath,
+		"importPath": importPath,
+		"toSlash":    toSlash,
+		"fromSlash":  fromSlash,
+		"winPath":    winPath,
+		"pathCase":   pathCase,
+
+		"license": license,
+
+		"freePort": freePort,
+	}
+}
+
+func b64enc(v any) (string, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+func b64dec(v any) (string, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return "", err
+	}
+	out, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	return string(out), nil
+}
+
+// sha256Sum returns the hex-encoded SHA-256 digest of v.
+func sha256Sum(v any) (string, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// md5Sum returns the hex-encoded MD5 digest of v.
+func md5Sum(v any) (string, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return "", err
+	}
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// shortHash returns the first n hex characters of the SHA-256 digest of v.
+func shortHash(n int, v any) (string, error) {
+	if n < 1 || n > sha256.Size*2 {
+		return "", fmt.Errorf("shortHash length must be between 1 and %d but got %d", sha256.Size*2, n)
+	}
+	sum, err := sha256Sum(v)
+	if err != nil {
+		return "", err
+	}
+	return sum[:n], nil
+}
+
+// toBytes converts a string or []byte template argument to a []byte.
+func toBytes(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	default:
+		return nil, fmt.Errorf("expected string or []byte but got %T", v)
+	}
+}
+
+// toJSON encodes v as compact JSON. Map keys are sorted.
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// toJSONPretty encodes v as indented JSON. Map keys are sorted.
+func toJSONPretty(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+func fromJSON(v any) (any, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	return out, nil
+}
+
+// toYAML encodes v as YAML, without a trailing newline. Map keys are sorted.
+func toYAML(v any) (string, error) {
+	out := &strings.Builder{}
+	enc := yaml.NewEncoder(out)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return "", fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+func fromYAML(v any) (any, error) {
+	data, err := toBytes(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to decode YAML: %w", err)
+	}
+	return out, nil
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// jsonString quotes s as a JSON string.
+func jsonString(s string) (string, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// indent prefixes each line of s with n spaces.
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// wrap reflows the text s so that no line is longer than width, where
+// possible. Paragraphs, separated by blank lines, are reflowed independently,
+// and words longer than width are placed on a line of their own.
+func wrap(width int, s string) (string, error) {
+	if width < 1 {
+		return "", fmt.Errorf("wrap width must be positive but got %d", width)
+	}
+	paragraphs := []string{}
+	for _, paragraph := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n\n") {
+		lines := []string{}
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		paragraphs = append(paragraphs, strings.Join(lines, "\n"))
+	}
+	return strings.Join(paragraphs, "\n\n"), nil
+}
+
+// wrapComment is like wrap but prefixes each line with prefix, eg. "// ".
+// width includes the prefix, which is trimmed of trailing space on blank
+// lines.
+func wrapComment(prefix string, width int, s string) (string, error) {
+	wrapped, err := wrap(max(width-utf8.RuneCountInString(prefix), 1), s)
+	if err != nil {
+		return "", err
+	}
+	return prefixLines(prefix, wrapped), nil
+}
+
+// prefixLines prefixes each line of s with prefix, which is trimmed of
+// trailing space on blank lines.
+func prefixLines(prefix, s string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " \t")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// lookup resolves the "."-separated path against v, returning nil if any
+// element of the path is missing.
+//
+// Each element selects a map key, an exported struct field, or, if it is an
+// integer, a slice or array index, eg. "services.0.name".
+func lookup(v any, path string) any {
+	if path == "" {
+		return v
+	}
+	value := reflect.ValueOf(v)
+	for _, key := range strings.Split(path, ".") {
+		for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		switch value.Kind() {
+		case reflect.Map:
+			if value.Type().Key().Kind() != reflect.String {
+				return nil
+			}
+			value = value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+		case reflect.Struct:
+			field, ok := value.Type().FieldByName(key)
+			if !ok || !field.IsExported() {
+				return nil
+			}
+			value = value.FieldByIndex(field.Index)
+		case reflect.Slice, reflect.Array:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= value.Len() {
+				return nil
+			}
+			value = value.Index(i)
+		default:
+			return nil
+		}
+		if !value.IsValid() {
+			return nil
+		}
+	}
+	return value.Interface()
+}
+
+// toList converts a slice or array template argument to a []any. A nil
+// argument is an empty list.
+func toList(v any) ([]any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list but got %T", v)
+	}
+	list := make([]any, value.Len())
+	for i := range list {
+		list[i] = value.Index(i).Interface()
+	}
+	return list, nil
+}
+
+// first returns the first element of list, or nil if it is empty.
+func first(list any) (any, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[0], nil
+}
+
+// last returns the last element of list, or nil if it is empty.
+func last(list any) (any, error) {
+	l, err := toList(list)
+	if err != nil || len(l) == 0 {
+		return nil, err
+	}
+	return l[len(l)-1], nil
+}
+
+// uniq returns the elements of list with duplicates removed, preserving the
+// order of first occurrence.
+func uniq(list any) ([]any, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := []any{}
+	for _, v := range l {
+		if !slices.ContainsFunc(out, func(seen any) bool { return reflect.DeepEqual(seen, v) }) {
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+// sortAlpha returns the elements of list formatted as strings and sorted.
+func sortAlpha(list any) ([]string, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, len(l))
+	for i, v := range l {
+		out[i] = fmt.Sprint(v)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// reverse returns the elements of list in reverse order.
+func reverse(list any) ([]any, error) {
+	l, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	slices.Reverse(l)
+	return l, nil
+}
+
+// join formats the elements of list as strings and joins them with sep.
+func join(sep string, list any) (string, error) {
+	strs, err := toList(list)
+	if err != nil {
+		return "", err
+	}
+	out := make([]string, len(strs))
+	for i, v := range strs {
+		out[i] = fmt.Sprint(v)
+	}
+	return strings.Join(out, sep), nil
+}
+
+// isLast reports whether index is the last of n indexes, eg. in a range loop
+// with {{ range $i, $v := .List }}{{ if isLast $i (len .List) }}.
+func isLast(index, n int) bool {
+	return index == n-1
+}
+
+// sep returns separator, unless index is the last of n indexes, eg.
+// {{ range $i, $v := .List }}{{ $v }}{{ sep ", " $i (len $.List) }}{{ end }}.
+func sep(separator string, index, n int) string {
+	if isLast(index, n) {
+		return ""
+	}
+	return separator
+}
+
+// formatNumber formats the integer or floating point number n in decimal,
+// with prec digits after the decimal point for floats, or the minimum number
+// of digits necessary to represent n exactly if prec is -1.
+func formatNumber(n any, prec int) (string, error) {
+	v := reflect.ValueOf(n)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if prec >= 0 {
+			return strconv.FormatFloat(float64(v.Int()), 'f', prec, 64), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if prec >= 0 {
+			return strconv.FormatFloat(float64(v.Uint()), 'f', prec, 64), nil
+		}
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', prec, v.Type().Bits()), nil
+	default:
+		return "", fmt.Errorf("expected a number but got %T", n)
+	}
+}
+
+// comma formats the number n with a comma between each group of thousands,
+// eg. 1234567.5 is "1,234,567.5".
+func comma(n any) (string, error) {
+	s, err := formatNumber(n, -1)
+	if err != nil {
+		return "", err
+	}
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(s, ".")
+	out := &strings.Builder{}
+	out.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			out.WriteByte(',')
+		}
+		out.WriteRune(digit)
+	}
+	if hasFrac {
+		out.WriteString("." + frac)
+	}
+	return out.String(), nil
+}
+
+// fixed formats the number n with exactly prec digits after the decimal
+// point, eg. {{ fixed 2 3.14159 }} is "3.14".
+func fixed(prec int, n any) (string, error) {
+	if prec < 0 {
+		return "", fmt.Errorf("precision must not be negative but got %d", prec)
+	}
+	return formatNumber(n, prec)
+}
+
+// toInt converts v, a number or a string containing an integer, to an int.
+// Floats are only converted if they have no fractional part.
+func toInt(v any) (int, error) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := value.Int(); n == int64(int(n)) {
+			return int(n), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := value.Uint(); n <= math.MaxInt {
+			return int(n), nil
+		}
+	case reflect.Float32, reflect.Float64:
+		f := value.Float()
+		if f != math.Trunc(f) {
+			return 0, fmt.Errorf("toInt: %v has a fractional part", v)
+		}
+		if f >= math.MinInt && f < math.MaxInt {
+			return int(f), nil
+		}
+	case reflect.String:
+		n, err := strconv.Atoi(strings.TrimSpace(value.String()))
+		if err != nil {
+			return 0, fmt.Errorf("toInt: %q is not an integer", v)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("toInt: expected a number or string but got %T", v)
+	}
+	return 0, fmt.Errorf("toInt: %v is out of range", v)
+}
+
+// toFloat converts v, a number or a string containing a number, to a float64.
+func toFloat(v any) (float64, error) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value.String()), 64)
+		if err != nil {
+			return 0, fmt.Errorf("toFloat: %q is not a number", v)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("toFloat: expected a number or string but got %T", v)
+	}
+}
+
+// toBool converts v to a bool. Strings may be any accepted by
+// strconv.ParseBool, or "yes", "no", "on" or "off", ignoring case, and
+// numbers are true if they are not zero.
+func toBool(v any) (bool, error) {
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.String:
+		str := strings.ToLower(strings.TrimSpace(value.String()))
+		switch str {
+		case "yes", "on":
+			return true, nil
+		case "no", "off":
+			return false, nil
+		}
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return false, fmt.Errorf("toBool: %q is not a boolean", v)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() != 0, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() != 0, nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float() != 0, nil
+	default:
+		return false, fmt.Errorf("toBool: expected a bool, number or string but got %T", v)
+	}
+}
+
+// toString formats v as a string. Numbers are formatted in decimal without
+// exponents, []byte is converted directly, and nil is the empty string.
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	if s, err := formatNumber(v, -1); err == nil {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// ternary returns trueVal if cond is true and falseVal otherwise, where truth
+// is as defined for the "if" action.
+func ternary(trueVal, falseVal, cond any) any {
+	if truth, _ := template.IsTrue(cond); truth {
+		return trueVal
+	}
+	return falseVal
+}
+
+// defaultValue returns value, or fallback if value is missing or empty as
+// defined for the "if" action.
+//
+// value is variadic so that fallback can be applied to a pipeline, eg.
+// {{ .Name | default "app" }}.
+func defaultValue(fallback any, value ...any) any {
+	if len(value) == 0 {
+		return fallback
+	}
+	if truth, _ := template.IsTrue(value[0]); !truth {
+		return fallback
+	}
+	return value[0]
+}
+
+// sqlReserved are common SQL reserved words, which sqlIdent suffixes with an
+// underscore.
+var sqlReserved = map[string]bool{
+	"all": true, "alter": true, "and": true, "as": true, "asc": true,
+	"between": true, "by": true, "case": true, "check": true, "column": true,
+	"constraint": true, "create": true, "cross": true, "default": true,
+	"delete": true, "desc": true, "distinct": true, "drop": true, "else": true,
+	"end": true, "exists": true, "false": true, "foreign": true, "from": true,
+	"full": true, "grant": true, "group": true, "having": true, "in": true,
+	"index": true, "inner": true, "insert": true, "into": true, "is": true,
+	"join": true, "key": true, "left": true, "like": true, "limit": true,
+	"not": true, "null": true, "offset": true, "on": true, "or": true,
+	"order": true, "outer": true, "primary": true, "references": true,
+	"right": true, "select": true, "set": true, "table": true, "then": true,
+	"to": true, "true": true, "union": true, "unique": true, "update": true,
+	"user": true, "using": true, "values": true, "when": true, "where": true,
+	"with": true,
+}
+
+// graphqlReserved are names that can't be used as GraphQL enum values, which
+// graphqlName suffixes with an underscore.
+var graphqlReserved = map[string]bool{"true": true, "false": true, "null": true}
+
+// identifier replaces each character of s that is not an ASCII letter, digit
+// or underscore with an underscore, and prefixes an underscore if the result
+// is empty or starts with a digit.
+func identifier(s string) string {
+	out := strings.Map(func(c rune) rune {
+		if c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			return c
+		}
+		return '_'
+	}, s)
+	if out == "" || out[0] >= '0' && out[0] <= '9' {
+		out = "_" + out
+	}
+	return out
+}
+
+// sqlIdent sanitises s into an unquoted SQL identifier, eg. "order" is
+// "order_" and "2nd place" is "_2nd_place". Reserved words are matched
+// case-insensitively.
+func sqlIdent(s string) string {
+	ident := identifier(s)
+	if sqlReserved[strings.ToLower(ident)] {
+		ident += "_"
+	}
+	return ident
+}
+
+// graphqlName sanitises s into a GraphQL name, eg. "first name" is
+// "first_name". A leading "__", which is reserved for introspection, is
+// reduced to a single underscore.
+func graphqlName(s string) string {
+	name := identifier(s)
+	if strings.HasPrefix(name, "__") {
+		name = "_" + strings.TrimLeft(name, "_")
+	}
+	if graphqlReserved[name] {
+		name += "_"
+	}
+	return name
+}
+
+// initials returns the uppercase first letter of each word in s, eg. "My Cool
+// Service", "myCoolService" and "my_cool_service" are all "MCS".
+func initials(s string) string {
+	out := strings.Builder{}
+	for _, word := range strings.Split(strcase.ToSnake(s), "_") {
+		if r, _ := utf8.DecodeRuneInString(word); r != utf8.RuneError {
+			out.WriteString(strings.ToUpper(string(r)))
+		}
+	}
+	return out.String()
+}
+
+// relpath returns the forward-slash path of the file to, relative to the
+// directory containing the file from, suitable for use in import statements.
+//
+// Both paths are relative to the destination. Paths that don't traverse to a
+// parent directory are prefixed with "./".
+func relpath(from, to string) (string, error) {
+	rel, err := filepath.Rel(filepath.Dir(filepath.FromSlash(from)), filepath.FromSlash(to))
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel, nil
+}
+
+// importPath joins module with the destination-relative directory rel using
+// forward slashes, eg. "github.com/org/repo/internal/foo".
+//
+// A trailing file name in rel, recognised by its extension, is removed, so
+// the path of a file in the package can be passed directly.
+func importPath(module, rel string) (string, error) {
+	rel = path.Clean(strings.ReplaceAll(rel, `\`, "/"))
+	if path.Ext(rel) != "" {
+		rel = path.Dir(rel)
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+		return "", fmt.Errorf("%q is outside the module", rel)
+	}
+	module = strings.TrimSuffix(module, "/")
+	if rel == "." {
+		return module, nil
+	}
+	return module + "/" + rel, nil
+}
+
+// toSlash replaces each backslash in p with a forward slash, regardless of the
+// host platform.
+func toSlash(p string) string {
+	return strings.ReplaceAll(p, `\`, "/")
+}
+
+// fromSlash replaces each forward slash in p with a backslash, regardless of
+// the host platform.
+func fromSlash(p string) string {
+	return strings.ReplaceAll(p, "/", `\`)
+}
+
+// winPath cleans p as a Windows path with backslash separators, eg.
+// "C:/Program Files//app/../bin" is `C:\Program Files\bin`. A leading
+// double separator, as in a UNC path, is preserved.
+func winPath(p string) string {
+	p = toSlash(p)
+	unc := strings.HasPrefix(p, "//")
+	p = path.Clean(p)
+	if unc {
+		p = "/" + p
+	}
+	return fromSlash(p)
+}
+
+// pathCase applies the named case style, eg. "snake" or "kebab", to each
+// "/"-separated segment of path independently.
+func pathCase(style, path string) (string, error) {
+	convert, ok := caseStyles[style]
+	if !ok {
+		return "", fmt.Errorf("unknown case style %q", style)
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = convert(segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// dataFileFunc returns the "dataFile" function, which parses the JSON or YAML
+// file at a path relative to root in src.
+//
+// Parsed files are cached, so the returned value must not be modified.
+func dataFileFunc(src source, root string) func(name string) (any, error) {
+	cache := map[string]any{}
+	return func(name string) (any, error) {
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("%q is outside the source directory", name)
+		}
+		name = filepath.Clean(name)
+		if value, ok := cache[name]; ok {
+			return value, nil
+		}
+		path := filepath.Join(root, name)
+		data, err := src.ReadFile(path)
+		if err != nil {
+			return nil, &FSError{Op: "read data file", Path: path, Err: err}
+		}
+		var value any
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".json":
+			value, err = fromJSON(data)
+		case ".yaml", ".yml":
+			value, err = fromYAML(data)
+		default:
+			return nil, fmt.Errorf("%s: unsupported data file type", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		cache[name] = value
+		return value, nil
+	}
+}
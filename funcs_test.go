@@ -0,0 +1,444 @@
+package scaffolder_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+	"github.com/TBD54566975/scaffolder/scaffoldertest"
+)
+
+func TestBase64(t *testing.T) {
+	ctx := map[string]any{"Secret": "hunter2", "Bytes": []byte("hunter2")}
+	assert.Equal(t, "aHVudGVyMg==", render(t, `{{ b64enc .Secret }}`, ctx))
+	assert.Equal(t, "aHVudGVyMg==", render(t, `{{ b64enc .Bytes }}`, ctx))
+	assert.Equal(t, "hunter2", render(t, `{{ .Secret | b64enc | b64dec }}`, ctx))
+}
+
+func TestHashes(t *testing.T) {
+	ctx := map[string]any{"Content": "hello world"}
+	assert.Equal(t, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", render(t, `{{ sha256 .Content }}`, ctx))
+	assert.Equal(t, "5eb63bbbe01eeed093cb22bb8f5acdc3", render(t, `{{ md5 .Content }}`, ctx))
+	assert.Equal(t, "b94d27b9", render(t, `{{ .Content | shortHash 8 }}`, ctx))
+	assert.Equal(t, "app.b94d27b9.js", render(t, `app.{{ shortHash 8 .Content }}.js`, ctx))
+}
+
+func TestJSON(t *testing.T) {
+	ctx := map[string]any{
+		"Settings": map[string]any{
+			"name":  "test",
+			"alpha": []int{1, 2},
+			"nested": map[string]any{
+				"z": true,
+				"a": nil,
+			},
+		},
+	}
+	assert.Equal(t, `{"alpha":[1,2],"name":"test","nested":{"a":null,"z":true}}`, render(t, `{{ toJson .Settings }}`, ctx))
+	assert.Equal(t, `{
+  "alpha": [
+    1,
+    2
+  ],
+  "name": "test",
+  "nested": {
+    "a": null,
+    "z": true
+  }
+}`, render(t, `{{ toJsonPretty .Settings }}`, ctx))
+	assert.Equal(t, "test", render(t, `{{ (fromJson (toJson .Settings)).name }}`, ctx))
+}
+
+func TestQuoting(t *testing.T) {
+	ctx := map[string]any{"Value": "it's a \"quote\"\\\nnext line"}
+	assert.Equal(t, `"it's a \"quote\"\\\nnext line"`, render(t, `{{ goString .Value }}`, ctx))
+	assert.Equal(t, "'it'\\''s a \"quote\"\\\nnext line'", render(t, `{{ shellQuote .Value }}`, ctx))
+	assert.Equal(t, `"it's a \"quote\"\\\nnext line"`, render(t, `{{ jsonString .Value }}`, ctx))
+	assert.Equal(t, `"\u003cscript\u003e"`, render(t, `{{ jsonString "<script>" }}`, ctx))
+	assert.Equal(t, `a\+b\.txt`, render(t, `{{ regexQuote "a+b.txt" }}`, ctx))
+}
+
+func TestYAML(t *testing.T) {
+	ctx := map[string]any{
+		"Config": map[string]any{
+			"name": "test",
+			"image": map[string]any{
+				"tag":        "latest",
+				"repository": "nginx",
+			},
+			"ports": []int{80, 443},
+		},
+	}
+	assert.Equal(t, `config:
+  image:
+    repository: nginx
+    tag: latest
+  name: test
+  ports:
+    - 80
+    - 443`, render(t, "config:\n{{ .Config | toYaml | indent 2 }}", ctx))
+	assert.Equal(t, "nginx", render(t, `{{ (fromYaml (toYaml .Config)).image.repository }}`, ctx))
+}
+
+func TestInitials(t *testing.T) {
+	for input, expected := range map[string]string{
+		"My Cool Service":  "MCS",
+		"my cool  service": "MCS",
+		"myCoolService":    "MCS",
+		"MyCoolService":    "MCS",
+		"HTTPServer":       "HS",
+		"my_cool_service":  "MCS",
+		"my-cool-service":  "MCS",
+		"":                 "",
+	} {
+		assert.Equal(t, expected, render(t, `{{ initials .Name }}`, map[string]any{"Name": input}), input)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	ctx := map[string]any{
+		"Long":  "The quick brown fox jumps over the lazy dog, then naps in the\nafternoon sun.\n\nA second paragraph.",
+		"Short": "short text",
+		"Word":  "a supercalifragilistic word",
+	}
+	assert.Equal(t, "The quick brown fox jumps\nover the lazy dog, then\nnaps in the afternoon\nsun.\n\nA second paragraph.", render(t, `{{ wrap 25 .Long }}`, ctx))
+	assert.Equal(t, "short text", render(t, `{{ wrap 80 .Short }}`, ctx))
+	assert.Equal(t, "a\nsupercalifragilistic\nword", render(t, `{{ .Word | wrap 10 }}`, ctx))
+	assert.Equal(t, "// The quick brown fox\n// jumps over the lazy\n// dog, then naps in the\n// afternoon sun.\n//\n// A second paragraph.", render(t, `{{ wrapComment "// " 25 .Long }}`, ctx))
+	assert.Equal(t, "# short text", render(t, `{{ wrapComment "# " 80 .Short }}`, ctx))
+}
+
+func TestLicense(t *testing.T) {
+	assert.Equal(t, "// Copyright (c) 2024 Acme Inc.\n//\n// SPDX-License-Identifier: MIT", render(t, `{{ license "MIT" 2024 "Acme Inc." "// " }}`, nil))
+	assert.Equal(t, `# Copyright 2024 Acme
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.`, render(t, `{{ license "Apache-2.0" "2024" "Acme" "# " }}`, nil))
+	assert.Equal(t, "/*\n * Copyright (c) 2024 Acme\n *\n * This Source Code Form is subject to the terms of the Mozilla Public\n * License, v. 2.0. If a copy of the MPL was not distributed with this\n * file, You can obtain one at https://mozilla.org/MPL/2.0/.\n */", render(t, `{{ license "MPL-2.0" 2024 "Acme" "/*" }}`, nil))
+	assert.Equal(t, "Copyright (c) 2024 Acme\n\nSPDX-License-Identifier: ISC", render(t, `{{ license "ISC" 2024 "Acme" "" }}`, nil))
+
+	src := writeTree(t, map[string]string{"LICENSE": `{{ license "WTFPL" 2024 "Acme" "" }}`})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unsupported license "WTFPL"`)
+}
+
+func TestLookup(t *testing.T) {
+	type service struct{ Name string }
+	ctx := map[string]any{
+		"Key": "db.port",
+		"Config": map[string]any{
+			"db":       map[string]any{"port": 5432},
+			"services": []any{map[string]any{"name": "api"}},
+			"structs":  []service{{Name: "worker"}},
+		},
+	}
+	assert.Equal(t, "5432", render(t, `{{ lookup .Config .Key }}`, ctx))
+	assert.Equal(t, "api", render(t, `{{ lookup .Config "services.0.name" }}`, ctx))
+	assert.Equal(t, "worker", render(t, `{{ lookup .Config "structs.0.Name" }}`, ctx))
+	assert.Equal(t, "true", render(t, `{{ eq nil (lookup .Config "db.host") }}`, ctx))
+	assert.Equal(t, "true", render(t, `{{ eq nil (lookup .Config "services.1.name") }}`, ctx))
+	assert.Equal(t, "missing", render(t, `{{ lookup .Config "db.port.value" | default "missing" }}`, ctx))
+}
+
+func TestListManipulation(t *testing.T) {
+	ctx := map[string]any{
+		"Strings": []string{"b", "a", "c", "a"},
+		"Any":     []any{3, "x", 3},
+		"Ints":    [3]int{2, 10, 1},
+		"Empty":   []string{},
+	}
+	assert.Equal(t, "b", render(t, `{{ first .Strings }}`, ctx))
+	assert.Equal(t, "2", render(t, `{{ first .Ints }}`, ctx))
+	assert.Equal(t, "a", render(t, `{{ last .Strings }}`, ctx))
+	assert.Equal(t, "1", render(t, `{{ last .Ints }}`, ctx))
+	assert.Equal(t, "<no value>", render(t, `{{ first .Empty }}`, ctx))
+	assert.Equal(t, "b,a,c", render(t, `{{ uniq .Strings | join "," }}`, ctx))
+	assert.Equal(t, "3 x", render(t, `{{ uniq .Any | join " " }}`, ctx))
+	assert.Equal(t, "a a b c", render(t, `{{ sortAlpha .Strings | join " " }}`, ctx))
+	assert.Equal(t, "1 10 2", render(t, `{{ sortAlpha .Ints | join " " }}`, ctx))
+	assert.Equal(t, "a c a b", render(t, `{{ reverse .Strings | join " " }}`, ctx))
+	assert.Equal(t, "1-10-2", render(t, `{{ reverse .Ints | join "-" }}`, ctx))
+	assert.Equal(t, "3x3", render(t, `{{ join "" .Any }}`, ctx))
+	assert.Equal(t, "", render(t, `{{ join "," .Empty }}`, ctx))
+}
+
+func TestSeparators(t *testing.T) {
+	ctx := map[string]any{"List": []string{"a", "b", "c"}, "One": []string{"a"}}
+	assert.Equal(t, "false false true", render(t, `{{ isLast 0 3 }} {{ isLast 1 3 }} {{ isLast 2 3 }}`, nil))
+	assert.Equal(t, ", |, |", render(t, `{{ sep ", " 0 3 }}|{{ sep ", " 1 3 }}|{{ sep ", " 2 3 }}`, nil))
+	assert.Equal(t, "a, b, c", render(t, `{{ range $i, $v := .List }}{{ $v }}{{ sep ", " $i (len $.List) }}{{ end }}`, ctx))
+	assert.Equal(t, "a.", render(t, `{{ range $i, $v := .One }}{{ $v }}{{ if isLast $i (len $.One) }}.{{ end }}{{ end }}`, ctx))
+}
+
+func TestNumberFormatting(t *testing.T) {
+	ctx := map[string]any{
+		"Int":      1234567,
+		"Negative": -1234567,
+		"Small":    -12,
+		"Uint":     uint64(1000),
+		"Float":    -9876543.21,
+		"Float32":  float32(0.75),
+	}
+	assert.Equal(t, "1,234,567", render(t, `{{ comma .Int }}`, ctx))
+	assert.Equal(t, "-1,234,567", render(t, `{{ comma .Negative }}`, ctx))
+	assert.Equal(t, "-12", render(t, `{{ comma .Small }}`, ctx))
+	assert.Equal(t, "1,000", render(t, `{{ comma .Uint }}`, ctx))
+	assert.Equal(t, "-9,876,543.21", render(t, `{{ comma .Float }}`, ctx))
+	assert.Equal(t, "999", render(t, `{{ comma 999 }}`, ctx))
+	assert.Equal(t, "1234567.00", render(t, `{{ fixed 2 .Int }}`, ctx))
+	assert.Equal(t, "-9876543.2", render(t, `{{ fixed 1 .Float }}`, ctx))
+	assert.Equal(t, "1", render(t, `{{ .Float32 | fixed 0 }}`, ctx))
+	assert.Equal(t, "0.750", render(t, `{{ fixed 3 .Float32 }}`, ctx))
+}
+
+func TestIdentifiers(t *testing.T) {
+	for _, test := range []struct {
+		input, sql, graphql string
+	}{
+		{"first name", "first_name", "first_name"},
+		{"2nd-place", "_2nd_place", "_2nd_place"},
+		{"order", "order_", "order"},
+		{"SELECT", "SELECT_", "SELECT"},
+		{"null", "null_", "null_"},
+		{"__typename", "__typename", "_typename"},
+		{"café", "caf_", "caf_"},
+		{"", "_", "_"},
+	} {
+		ctx := map[string]any{"Input": test.input}
+		assert.Equal(t, test.sql, render(t, `{{ sqlIdent .Input }}`, ctx), "%q", test.input)
+		assert.Equal(t, test.graphql, render(t, `{{ graphqlName .Input }}`, ctx), "%q", test.input)
+	}
+}
+
+func TestCoercion(t *testing.T) {
+	ctx := map[string]any{
+		"Port":     "8080",
+		"Replicas": 3.0,
+		"Enabled":  "yes",
+		"Debug":    "false",
+		"Ratio":    " 0.25 ",
+		"Big":      1e6,
+		"Bytes":    []byte("raw"),
+	}
+	assert.Equal(t, "8081", render(t, `{{ $p := toInt .Port }}{{ if eq $p 8080 }}8081{{ end }}`, ctx))
+	assert.Equal(t, "true", render(t, `{{ gt (toInt .Replicas) 1 }}`, ctx))
+	assert.Equal(t, "7", render(t, `{{ toInt 7 }}`, ctx))
+	assert.Equal(t, "0.25", render(t, `{{ toFloat .Ratio }}`, ctx))
+	assert.Equal(t, "3", render(t, `{{ toFloat 3 }}`, ctx))
+	assert.Equal(t, "on off", render(t, `{{ if toBool .Enabled }}on{{ end }} {{ if not (toBool .Debug) }}off{{ end }}`, ctx))
+	assert.Equal(t, "true false true", render(t, `{{ toBool "1" }} {{ toBool 0 }} {{ toBool true }}`, ctx))
+	assert.Equal(t, "1000000 raw 42  true", render(t, `{{ toString .Big }} {{ toString .Bytes }} {{ toString 42 }} {{ toString nil }} {{ toString true }}`, ctx))
+
+	for tmpl, expected := range map[string]string{
+		`{{ toInt "eighty" }}`: `toInt: "eighty" is not an integer`,
+		`{{ toInt 1.5 }}`:      "toInt: 1.5 has a fractional part",
+		`{{ toInt true }}`:     "toInt: expected a number or string but got bool",
+		`{{ toFloat "x" }}`:    `toFloat: "x" is not a number`,
+		`{{ toBool "maybe" }}`: `toBool: "maybe" is not a boolean`,
+		`{{ toBool .Bytes }}`:  "toBool: expected a bool, number or string but got []uint8",
+	} {
+		src := writeTree(t, map[string]string{"out": tmpl})
+		err := scaffolder.Scaffold(src, t.TempDir(), ctx)
+		assert.Error(t, err, tmpl)
+		assert.Contains(t, err.Error(), expected, tmpl)
+	}
+}
+
+func TestPorts(t *testing.T) {
+	tmpl := `{{ randPort 8000 8999 }} {{ randPort 8000 8999 }} {{ randPort 9000 9000 }}`
+	first := render(t, tmpl, nil, scaffolder.RandomSeed(42))
+	assert.Equal(t, first, render(t, tmpl, nil, scaffolder.RandomSeed(42)))
+	ports := strings.Fields(first)
+	assert.Equal(t, 3, len(ports))
+	for _, port := range ports[:2] {
+		n, err := strconv.Atoi(port)
+		assert.NoError(t, err)
+		assert.True(t, n >= 8000 && n <= 8999, "%d", n)
+	}
+	assert.Equal(t, "9000", ports[2])
+
+	src := writeTree(t, map[string]string{
+		"{{ range .Names }}{{ push . . }}{{ end }}/port": "{{ randPort 1024 65535 }}",
+	})
+	ctx := map[string]any{"Names": []string{"a", "b", "c", "d", "e"}}
+	scaffoldPorts := func() map[string]string {
+		dest := t.TempDir()
+		err := scaffolder.Scaffold(src, dest, ctx, scaffolder.RandomSeed(42))
+		assert.NoError(t, err)
+		ports := map[string]string{}
+		for _, name := range []string{"a", "b", "c", "d", "e"} {
+			data, err := os.ReadFile(filepath.Join(dest, name, "port"))
+			assert.NoError(t, err)
+			ports[name] = string(data)
+		}
+		return ports
+	}
+	pushed := scaffoldPorts()
+	for range 3 {
+		assert.Equal(t, pushed, scaffoldPorts())
+	}
+
+	port, err := strconv.Atoi(render(t, `{{ freePort }}`, nil))
+	assert.NoError(t, err)
+	assert.True(t, port > 0 && port <= 65535, "%d", port)
+
+	src = writeTree(t, map[string]string{"out": `{{ randPort 10 1 }}`})
+	err = scaffolder.Scaffold(src, t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "randPort: invalid port range 10-1")
+}
+
+func TestTernary(t *testing.T) {
+	ctx := map[string]any{"Yes": true, "No": false, "Count": 0, "Name": "x"}
+	assert.Equal(t, "a", render(t, `{{ ternary "a" "b" .Yes }}`, ctx))
+	assert.Equal(t, "b", render(t, `{{ ternary "a" "b" .No }}`, ctx))
+	assert.Equal(t, "b", render(t, `{{ ternary "a" "b" .Count }}`, ctx))
+	assert.Equal(t, "a", render(t, `{{ .Name | ternary "a" "b" }}`, ctx))
+}
+
+func TestDefault(t *testing.T) {
+	ctx := map[string]any{"Name": "svc", "Empty": "", "List": []string{}, "Nil": nil}
+	assert.Equal(t, "svc", render(t, `{{ default "app" .Name }}`, ctx))
+	assert.Equal(t, "app", render(t, `{{ default "app" .Empty }}`, ctx))
+	assert.Equal(t, "app", render(t, `{{ default "app" .List }}`, ctx))
+	assert.Equal(t, "app", render(t, `{{ default "app" .Nil }}`, ctx))
+	assert.Equal(t, "app", render(t, `{{ .Missing | default "app" }}`, ctx))
+	assert.Equal(t, "svc", render(t, `{{ .Name | default "app" }}`, ctx))
+}
+
+func TestRelpath(t *testing.T) {
+	for _, test := range []struct {
+		from, to, expected string
+	}{
+		{"src/index.ts", "src/util.ts", "./util.ts"},
+		{"src/index.ts", "src/lib/deep/util.ts", "./lib/deep/util.ts"},
+		{"src/lib/deep/index.ts", "src/util.ts", "../../util.ts"},
+		{"index.ts", "util.ts", "./util.ts"},
+	} {
+		ctx := map[string]any{"From": test.from, "To": test.to}
+		assert.Equal(t, test.expected, render(t, `{{ relpath .From .To }}`, ctx), "%s -> %s", test.from, test.to)
+	}
+}
+
+func TestPathSeparators(t *testing.T) {
+	ctx := map[string]any{"Unix": "src/app/main.go", "Windows": `src\app\main.go`}
+	assert.Equal(t, `src\app\main.go`, render(t, `{{ fromSlash .Unix }}`, ctx))
+	assert.Equal(t, "src/app/main.go", render(t, `{{ toSlash .Windows }}`, ctx))
+	assert.Equal(t, "src/app/main.go", render(t, `{{ fromSlash .Unix | toSlash }}`, ctx))
+	assert.Equal(t, `C:\Program Files\bin`, render(t, `{{ winPath "C:/Program Files//app/../bin/" }}`, ctx))
+	assert.Equal(t, `\\server\share\dir`, render(t, `{{ winPath "//server/share/./dir" }}`, ctx))
+	assert.Equal(t, `src\app\main.go`, render(t, `{{ winPath .Windows }}`, ctx))
+}
+
+func TestImportPath(t *testing.T) {
+	for _, test := range []struct {
+		rel, expected string
+	}{
+		{"internal/foo", "github.com/org/repo/internal/foo"},
+		{"internal/foo/foo.go", "github.com/org/repo/internal/foo"},
+		{`internal\foo\bar`, "github.com/org/repo/internal/foo/bar"},
+		{"./cmd/app/", "github.com/org/repo/cmd/app"},
+		{".", "github.com/org/repo"},
+		{"main.go", "github.com/org/repo"},
+	} {
+		ctx := map[string]any{"Rel": test.rel}
+		assert.Equal(t, test.expected, render(t, `{{ importPath "github.com/org/repo" .Rel }}`, ctx), "%s", test.rel)
+	}
+}
+
+func TestPathCase(t *testing.T) {
+	ctx := map[string]any{"Path": "MyService/HTTP Handlers/userProfile"}
+	assert.Equal(t, "my_service/http_handlers/user_profile", render(t, `{{ pathCase "snake" .Path }}`, ctx))
+	assert.Equal(t, "my-service/http-handlers/user-profile", render(t, `{{ pathCase "kebab" .Path }}`, ctx))
+}
+
+func TestSecret(t *testing.T) {
+	provider := scaffolder.SecretProvider(func(name string) (string, error) {
+		if name == "token" {
+			return "hunter2", nil
+		}
+		return "", errors.New("not found")
+	})
+	assert.Equal(t, "TOKEN=hunter2", render(t, `TOKEN={{ secret "token" }}`, nil, provider))
+
+	src := writeTree(t, map[string]string{"out": `{{ secret "missing" }}`})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, provider)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `secret "missing": not found`)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no secret provider configured")
+
+	src = writeTree(t, map[string]string{"out": `{{ secret "token" | toInt }}`})
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, provider)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "hunter2")
+	assert.Contains(t, err.Error(), "[redacted]")
+
+	t.Setenv("APP_TOKEN", "from-env")
+	assert.Equal(t, "from-env", render(t, `{{ secret "TOKEN" }}`, nil, scaffolder.SecretProvider(scaffolder.EnvSecrets("APP_"))))
+
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "token"), []byte("from-file\n"), 0o600))
+	assert.Equal(t, "from-file", render(t, `{{ secret "token" }}`, nil, scaffolder.SecretProvider(scaffolder.FileSecrets(dir))))
+}
+
+func TestRoots(t *testing.T) {
+	src := writeTree(t, map[string]string{"out": "{{ sourceRoot }} -> {{ destRoot }}"})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dest, "out"))
+	assert.NoError(t, err)
+	assert.Equal(t, src+" -> "+dest, string(content))
+}
+
+func TestDataFile(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"data/countries.yaml":                       "AU: Australia\nNZ: New Zealand\n",
+		"{{ range .Codes }}{{ push . . }}{{ end }}": `{{ index (dataFile "data/countries.yaml") . }}`,
+		"escape.txt":                                "",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Codes": []string{"AU", "NZ"}}, scaffolder.Exclude("^data"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "AU", Mode: 0o600, Content: "Australia"},
+		{Name: "NZ", Mode: 0o600, Content: "New Zealand"},
+		{Name: "escape.txt", Mode: 0o600},
+	})
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "escape.txt"), []byte(`{{ dataFile "../secrets.json" }}`), 0o600))
+	err = scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Codes": []string{}}, scaffolder.Exclude("^data"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "outside the source directory")
+}
+
+// render scaffolds a single file containing tmpl and returns its rendered content.
+func render(t *testing.T, tmpl string, ctx any, options ...scaffolder.Option) string {
+	t.Helper()
+	src := writeTree(t, map[string]string{"out": tmpl})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, ctx, options...)
+	assert.NoError(t, err)
+	content, err := os.ReadFile(filepath.Join(dest, "out"))
+	assert.NoError(t, err)
+	return string(content)
+}
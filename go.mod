@@ -6,7 +6,9 @@ require (
 	github.com/alecthomas/assert/v2 v2.10.0
 	github.com/alecthomas/kong v1.2.1
 	github.com/dop251/goja v0.0.0-20241009100908-5f46f2705ca3
+	github.com/hexops/gotextdiff v1.0.3
 	github.com/iancoleman/strcase v0.3.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -14,6 +16,5 @@ require (
 	github.com/dlclark/regexp2 v1.11.4 // indirect
 	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
 	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
-	github.com/hexops/gotextdiff v1.0.3 // indirect
 	golang.org/x/text v0.3.8 // indirect
 )
@@ -0,0 +1,79 @@
+package scaffolder
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// licenseHeaders are the headers returned by the license function, keyed by
+// SPDX identifier. "{{year}}" and "{{holder}}" are replaced with the copyright
+// year and holder.
+var licenseHeaders = map[string]string{
+	"Apache-2.0": `Copyright {{year}} {{holder}}
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.`,
+	"MIT": `Copyright (c) {{year}} {{holder}}
+
+SPDX-License-Identifier: MIT`,
+	"BSD-2-Clause": `Copyright (c) {{year}} {{holder}}
+
+SPDX-License-Identifier: BSD-2-Clause`,
+	"BSD-3-Clause": `Copyright (c) {{year}} {{holder}}
+
+SPDX-License-Identifier: BSD-3-Clause`,
+	"ISC": `Copyright (c) {{year}} {{holder}}
+
+SPDX-License-Identifier: ISC`,
+	"MPL-2.0": `Copyright (c) {{year}} {{holder}}
+
+This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at https://mozilla.org/MPL/2.0/.`,
+	"GPL-3.0-or-later": `Copyright (C) {{year}} {{holder}}
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.`,
+}
+
+// license returns the header for the license with the SPDX identifier id,
+// commented with style.
+//
+// style is the prefix for each line, as for wrapComment, eg. "// " or "# ", or
+// "/*" for a block comment. An empty style returns the header uncommented.
+func license(id string, year any, holder, style string) (string, error) {
+	header, ok := licenseHeaders[id]
+	if !ok {
+		ids := make([]string, 0, len(licenseHeaders))
+		for id := range licenseHeaders {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+		return "", fmt.Errorf("unsupported license %q, expected one of %s", id, strings.Join(ids, ", "))
+	}
+	header = strings.NewReplacer("{{year}}", fmt.Sprint(year), "{{holder}}", holder).Replace(header)
+	if strings.TrimSpace(style) == "/*" {
+		return "/*\n" + prefixLines(" * ", header) + "\n */", nil
+	}
+	return prefixLines(style, header), nil
+}
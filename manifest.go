@@ -0,0 +1,212 @@
+package scaffolder
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// manifest is a record of the regular files generated by a scaffolding run,
+// as written by WriteManifest.
+type manifest struct {
+	Files []manifestFile `json:"files"`
+}
+
+type manifestFile struct {
+	// Path is the forward-slash path of the file relative to the directory
+	// containing the manifest.
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+func hashContent(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// readPreviousManifest records the hashes from the manifest written by a
+// previous run, if OverwriteUnmodified is enabled and it exists.
+func (s *state) readPreviousManifest() error {
+	if !s.overwriteUnmodified {
+		return nil
+	}
+	manifestPath := filepath.Join(s.target, s.manifestPath)
+	data, err := s.dst.ReadFile(manifestPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return &FSError{Op: "read manifest", Path: manifestPath, Err: err}
+	}
+	m, err := parseManifest(manifestPath, data)
+	if err != nil {
+		return err
+	}
+	for _, file := range m.Files {
+		s.previousHashes[filepath.Join(filepath.Dir(manifestPath), filepath.FromSlash(file.Path))] = file.SHA256
+	}
+	return nil
+}
+
+// modified reports whether the existing file at dstPath differs from what was
+// recorded in the previous manifest, recording the hash to carry forward to the
+// new manifest if so.
+func (s *state) modified(dstPath string) bool {
+	existing, err := s.dst.ReadFile(dstPath)
+	if err != nil {
+		return false
+	}
+	previous, ok := s.previousHashes[dstPath]
+	if ok && previous == hashContent(existing) {
+		return false
+	}
+	s.keptHashes[dstPath] = previous
+	return true
+}
+
+// writeManifest writes the manifest of generated files, if enabled.
+func (s *state) writeManifest() error {
+	if s.manifestPath == "" {
+		return nil
+	}
+	manifestPath := filepath.Join(s.target, s.manifestPath)
+	base := filepath.Dir(manifestPath)
+	paths := make([]string, 0, len(s.generated))
+	for path := range s.generated {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	m := manifest{Files: []manifestFile{}}
+	if s.mergeManifest {
+		data, err := s.dst.ReadFile(manifestPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return &FSError{Op: "read manifest", Path: manifestPath, Err: err}
+		}
+		if err == nil {
+			previous, err := parseManifest(manifestPath, data)
+			if err != nil {
+				return err
+			}
+			for _, file := range previous.Files {
+				if !s.generated[filepath.Join(base, filepath.FromSlash(file.Path))] {
+					m.Files = append(m.Files, file)
+				}
+			}
+		}
+	}
+	for _, path := range paths {
+		if info, err := s.dst.Lstat(path); err != nil || !info.Mode().IsRegular() || path == manifestPath {
+			continue
+		}
+		data, err := s.dst.ReadFile(path)
+		if err != nil {
+			return &FSError{Op: "read generated file", Path: path, Err: err}
+		}
+		hash := hashContent(data)
+		if kept, ok := s.keptHashes[path]; ok {
+			if kept == "" {
+				// Not generated by a previous run, so not ours to record.
+				continue
+			}
+			// Record the generated rather than the modified content, so that
+			// the file is still considered modified by subsequent runs.
+			hash = kept
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+		m.Files = append(m.Files, manifestFile{Path: filepath.ToSlash(rel), SHA256: hash})
+	}
+	slices.SortFunc(m.Files, func(a, b manifestFile) int { return strings.Compare(a.Path, b.Path) })
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := s.ensureDir(base); err != nil {
+		return err
+	}
+	if err := s.dst.WriteFile(manifestPath, append(data, '\n'), 0600); err != nil {
+		return &FSError{Op: "write manifest", Path: manifestPath, Err: err}
+	}
+	return nil
+}
+
+func readManifest(path string) (manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest{}, &FSError{Op: "read manifest", Path: path, Err: err}
+	}
+	return parseManifest(path, data)
+}
+
+func parseManifest(path string, data []byte) (manifest, error) {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("%s: failed to decode manifest: %w", path, err)
+	}
+	for _, file := range m.Files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Path)) {
+			return m, fmt.Errorf("%s: %q is outside the manifest directory", path, file.Path)
+		}
+	}
+	return m, nil
+}
+
+// Clean removes the files recorded in the manifest at manifestPath, as
+// written by WriteManifest, along with any directories left empty.
+//
+// Files that have been modified since they were generated are kept and
+// reported in the returned error; files that no longer exist are ignored. The
+// manifest itself is removed once every file it records has been removed.
+func Clean(manifestPath string) error {
+	m, err := readManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+	base := filepath.Dir(manifestPath)
+	var errs []error
+	dirs := map[string]bool{}
+	for _, file := range m.Files {
+		path := filepath.Join(base, filepath.FromSlash(file.Path))
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, &FSError{Op: "read file", Path: path, Err: err})
+			continue
+		}
+		if hashContent(data) != file.SHA256 {
+			errs = append(errs, fmt.Errorf("%s: modified since it was generated", path))
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, &FSError{Op: "remove file", Path: path, Err: err})
+			continue
+		}
+		for dir := filepath.Dir(file.Path); dir != "."; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	// Remove the deepest directories first, ignoring those still in use.
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	slices.SortFunc(sorted, func(a, b string) int { return strings.Count(b, "/") - strings.Count(a, "/") })
+	for _, dir := range sorted {
+		_ = os.Remove(filepath.Join(base, filepath.FromSlash(dir)))
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := os.Remove(manifestPath); err != nil {
+		return &FSError{Op: "remove manifest", Path: manifestPath, Err: err}
+	}
+	return nil
+}
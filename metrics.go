@@ -0,0 +1,65 @@
+package scaffolder
+
+import "time"
+
+// Metrics records where time was spent during a scaffold, and what was
+// generated. See CollectMetrics.
+//
+// Time spent in nested templates, such as those evaluated by include, is also
+// counted towards the template that includes them.
+type Metrics struct {
+	// ParseTime is the total time spent parsing templates, including path
+	// names and symlink targets.
+	ParseTime time.Duration
+	// ExecuteTime is the total time spent executing parsed templates and
+	// rendering files with renderers added by extensions.
+	ExecuteTime time.Duration
+	// WriteTime is the total time spent writing files and symlinks to the
+	// destination.
+	WriteTime time.Duration
+
+	// Templates is the number of templates parsed.
+	Templates int
+	// Files, Directories and Symlinks are the number of each written to the
+	// destination, not including the destination itself.
+	Files       int
+	Directories int
+	Symlinks    int
+}
+
+// CollectMetrics records timings and counts for the scaffold in m, which is
+// reset when scaffolding starts.
+func CollectMetrics(m *Metrics) Option {
+	return func(so *scaffoldOptions) {
+		so.metrics = m
+	}
+}
+
+func (m *Metrics) addParse(start time.Time) {
+	if m != nil {
+		m.ParseTime += time.Since(start)
+		m.Templates++
+	}
+}
+
+func (m *Metrics) addExecute(start time.Time) {
+	if m != nil {
+		m.ExecuteTime += time.Since(start)
+	}
+}
+
+// addWrite records the write of an entry of the given kind started at start.
+func (m *Metrics) addWrite(start time.Time, kind EntryKind) {
+	if m == nil {
+		return
+	}
+	m.WriteTime += time.Since(start)
+	switch kind {
+	case EntryFile:
+		m.Files++
+	case EntryDir:
+		m.Directories++
+	case EntrySymlink:
+		m.Symlinks++
+	}
+}
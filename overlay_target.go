@@ -0,0 +1,196 @@
+package scaffolder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing/fstest"
+	"time"
+)
+
+// overlayTarget is a target that reads through to the directory dir on disk,
+// but buffers all changes in memory, so that options which inspect existing
+// files behave as they would when scaffolding into dir.
+//
+// Paths are relative to dir, as for memTarget. Changes to the mode, times and
+// owner of files that exist only on disk are not recorded.
+type overlayTarget struct {
+	dir string
+	mem *memTarget
+	// Paths on disk that have been removed from the overlay.
+	removed map[string]bool
+}
+
+var _ target = (*overlayTarget)(nil)
+
+func newOverlayTarget(dir string) *overlayTarget {
+	return &overlayTarget{dir: dir, mem: &memTarget{files: fstest.MapFS{}}, removed: map[string]bool{}}
+}
+
+// inMem reports whether p has been written to the overlay.
+func (o *overlayTarget) inMem(p string) bool {
+	_, ok := o.mem.files[o.mem.name(p)]
+	return ok
+}
+
+// disk returns the path of p on disk, or false if it has been removed from
+// the overlay or the overlay has its own entry for p.
+func (o *overlayTarget) disk(p string) (string, bool) {
+	if o.inMem(p) || o.removed[o.mem.name(p)] {
+		return "", false
+	}
+	return filepath.Join(o.dir, p), true
+}
+
+func (o *overlayTarget) MkdirAll(p string, perm os.FileMode) error {
+	if info, err := o.Lstat(p); err == nil {
+		if !info.IsDir() {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+		}
+		if !o.inMem(p) {
+			return nil
+		}
+	}
+	return o.mem.MkdirAll(p, perm)
+}
+
+func (o *overlayTarget) ReadFile(p string) ([]byte, error) {
+	if path, ok := o.disk(p); ok {
+		return os.ReadFile(path)
+	}
+	return o.mem.ReadFile(p)
+}
+
+func (o *overlayTarget) ReadDir(p string) ([]fs.DirEntry, error) {
+	entries := []fs.DirEntry{}
+	found := false
+	if !o.removed[o.mem.name(p)] {
+		onDisk, err := os.ReadDir(filepath.Join(o.dir, p))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		found = err == nil
+		for _, entry := range onDisk {
+			child := filepath.Join(p, entry.Name())
+			if !o.removed[o.mem.name(child)] && !o.inMem(child) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if o.inMem(p) || o.mem.name(p) == "." {
+		inMem, err := o.mem.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+		found = true
+		entries = append(entries, inMem...)
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: fs.ErrNotExist}
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (o *overlayTarget) WriteFile(p string, data []byte, perm os.FileMode) error {
+	if info, err := o.Lstat(p); err == nil && !o.inMem(p) {
+		if !info.Mode().IsRegular() {
+			return &fs.PathError{Op: "open", Path: p, Err: fmt.Errorf("not a regular file")}
+		}
+		// Like os.WriteFile, the mode of an existing file is unchanged.
+		perm = info.Mode().Perm()
+	}
+	if err := o.mem.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	return o.mem.WriteFile(p, data, perm)
+}
+
+func (o *overlayTarget) Chmod(p string, mode os.FileMode) error {
+	if path, ok := o.disk(p); ok {
+		_, err := os.Lstat(path)
+		return err
+	}
+	return o.mem.Chmod(p, mode)
+}
+
+func (o *overlayTarget) Chtimes(p string, atime, mtime time.Time) error {
+	if path, ok := o.disk(p); ok {
+		_, err := os.Lstat(path)
+		return err
+	}
+	return o.mem.Chtimes(p, atime, mtime)
+}
+
+func (o *overlayTarget) Lchown(p string, uid, gid int) error {
+	if path, ok := o.disk(p); ok {
+		_, err := os.Lstat(path)
+		return err
+	}
+	return o.mem.Lchown(p, uid, gid)
+}
+
+func (o *overlayTarget) Symlink(oldname, newname string) error {
+	if _, err := o.Lstat(newname); err == nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	if err := o.mem.MkdirAll(filepath.Dir(newname), 0700); err != nil {
+		return err
+	}
+	return o.mem.Symlink(oldname, newname)
+}
+
+func (o *overlayTarget) Remove(p string) error {
+	if path, ok := o.disk(p); ok {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if entries, err := o.ReadDir(p); err != nil {
+				return err
+			} else if len(entries) > 0 {
+				return &fs.PathError{Op: "remove", Path: p, Err: fmt.Errorf("directory not empty")}
+			}
+		}
+		o.removed[o.mem.name(p)] = true
+		return nil
+	}
+	if err := o.mem.Remove(p); err != nil {
+		return err
+	}
+	o.removed[o.mem.name(p)] = true
+	return nil
+}
+
+func (o *overlayTarget) Lstat(p string) (fs.FileInfo, error) {
+	if path, ok := o.disk(p); ok {
+		return os.Lstat(path)
+	}
+	return o.mem.Lstat(p)
+}
+
+func (o *overlayTarget) Stat(p string) (fs.FileInfo, error) {
+	for range 255 {
+		info, err := o.Lstat(p)
+		if err != nil || info.Mode()&fs.ModeSymlink == 0 {
+			return info, err
+		}
+		var target string
+		if path, ok := o.disk(p); ok {
+			if target, err = os.Readlink(path); err != nil {
+				return nil, err
+			}
+		} else {
+			target = string(o.mem.files[o.mem.name(p)].Data)
+		}
+		if filepath.IsAbs(target) {
+			return os.Stat(target)
+		}
+		p = filepath.Join(filepath.Dir(p), target)
+	}
+	return nil, &fs.PathError{Op: "stat", Path: p, Err: fmt.Errorf("too many levels of symbolic links")}
+}
@@ -0,0 +1,56 @@
+package scaffolder
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+)
+
+// RandomSeed seeds the random choices made by template functions such as
+// randPort, so that output is reproducible. Without it, a random seed is used
+// for each scaffold.
+func RandomSeed(seed uint64) Option {
+	return func(so *scaffoldOptions) {
+		so.random.seed(seed)
+	}
+}
+
+// random is the source of randomness for template functions.
+type random struct {
+	rng *rand.Rand
+}
+
+func (r *random) seed(seed uint64) {
+	r.rng = rand.New(rand.NewPCG(seed, 0))
+}
+
+// intN returns a random integer in [0, n).
+func (r *random) intN(n int) int {
+	if r.rng == nil {
+		r.seed(rand.Uint64())
+	}
+	return r.rng.IntN(n)
+}
+
+// randPort returns a random port between low and high inclusive, eg.
+// {{ randPort 8000 8999 }}. Ports are chosen in the order they are called, so
+// are reproducible with RandomSeed.
+func (r *random) randPort(low, high int) (int, error) {
+	if low < 1 || high > 65535 || low > high {
+		return 0, fmt.Errorf("randPort: invalid port range %d-%d", low, high)
+	}
+	return low + r.intN(high-low+1), nil
+}
+
+// freePort returns a TCP port that is currently available on the loopback
+// interface, by binding to an ephemeral port and releasing it.
+//
+// Another process may bind the port before the generated code does.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("freePort: %w", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,72 @@
+package scaffolder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// recordOp is an operation written by RecordTo.
+type recordOp struct {
+	// Op is one of "mkdir", "write" or "symlink".
+	Op string `json:"op"`
+	// Path is the forward-slash path of the entry relative to the destination.
+	Path   string `json:"path"`
+	Mode   string `json:"mode,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// RecordTo writes a record of each operation performed while scaffolding to w,
+// as a JSON object per line, so that output can be audited or compared across
+// runs, eg.
+//
+//	{"op":"mkdir","path":"cmd","mode":"0700"}
+//	{"op":"write","path":"cmd/main.go","mode":"0600","sha256":"…"}
+//	{"op":"symlink","path":"latest","target":"cmd"}
+//
+// Paths are relative to the destination, and modes are those the entries were
+// created with, before ApplyModes and the like are applied. Given the same
+// template and context, the record is identical between runs.
+func RecordTo(w io.Writer) Option {
+	return func(so *scaffoldOptions) {
+		so.record = json.NewEncoder(w)
+	}
+}
+
+// recordEntry records the creation of the entry at path, if RecordTo is used.
+func (s *state) recordEntry(path string, kind EntryKind, symlinkTarget string) error {
+	if s.record == nil {
+		return nil
+	}
+	rel, err := filepath.Rel(s.target, path)
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", path, err)
+	}
+	op := recordOp{Path: filepath.ToSlash(rel)}
+	switch kind {
+	case EntrySymlink:
+		op.Op = "symlink"
+		op.Target = filepath.ToSlash(symlinkTarget)
+	case EntryDir, EntryFile:
+		info, err := s.dst.Stat(path)
+		if err != nil {
+			return &FSError{Op: "record entry", Path: path, Err: err}
+		}
+		op.Op = "mkdir"
+		op.Mode = fmt.Sprintf("%04o", info.Mode().Perm())
+		if kind == EntryFile {
+			data, err := s.dst.ReadFile(path)
+			if err != nil {
+				return &FSError{Op: "record entry", Path: path, Err: err}
+			}
+			op.Op = "write"
+			op.SHA256 = hashContent(data)
+		}
+	}
+	if err := s.record.Encode(op); err != nil {
+		return fmt.Errorf("failed to record %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package scaffolder
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	keepMarker = "scaffolder:keep"
+	endMarker  = "scaffolder:end"
+)
+
+// commentClosers end the comment containing a keep marker, and are not part of
+// the region's name.
+var commentClosers = []string{"-->", "*/", "#}", "%>"}
+
+// region is a protected region: the lines between a keep marker line and its
+// end marker line.
+type region struct {
+	key  string
+	body string
+}
+
+// parseRegions returns the bodies of the protected regions in content, keyed
+// by name.
+//
+// A region is named by the text following the keep marker on its line, less
+// any comment closer. Unnamed regions are keyed by their position among
+// unnamed regions.
+func parseRegions(content string) (map[string]string, error) {
+	regions := map[string]string{}
+	err := walkRegions(content, func(line string, r *region) {
+		if r != nil {
+			regions[r.key] = r.body
+		}
+	})
+	return regions, err
+}
+
+// walkRegions calls fn for each line of content outside a region body,
+// including marker lines, and for each complete region body.
+func walkRegions(content string, fn func(line string, r *region)) error {
+	var current *region
+	unnamed := 0
+	seen := map[string]bool{}
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch {
+		case strings.Contains(line, keepMarker):
+			if current != nil {
+				return fmt.Errorf("nested %q region", keepMarker)
+			}
+			fn(line, nil)
+			key := regionKey(line[strings.Index(line, keepMarker)+len(keepMarker):])
+			if key == "" {
+				key = "#" + strconv.Itoa(unnamed)
+				unnamed++
+			} else if seen[key] {
+				return fmt.Errorf("duplicate %q region %q", keepMarker, key)
+			}
+			seen[key] = true
+			current = &region{key: key}
+		case strings.Contains(line, endMarker):
+			if current == nil {
+				return fmt.Errorf("%q without %q", endMarker, keepMarker)
+			}
+			fn("", current)
+			fn(line, nil)
+			current = nil
+		case current != nil:
+			current.body += line
+		default:
+			fn(line, nil)
+		}
+	}
+	if current != nil {
+		return fmt.Errorf("unterminated %q region %q", keepMarker, current.key)
+	}
+	return nil
+}
+
+// regionKey returns the name of a region from the text following its keep
+// marker.
+func regionKey(text string) string {
+	key := strings.TrimSpace(text)
+	for _, closer := range commentClosers {
+		if trimmed, ok := strings.CutSuffix(key, closer); ok {
+			return strings.TrimSpace(trimmed)
+		}
+	}
+	return key
+}
+
+// preserveRegions returns generated with the body of each protected region
+// replaced by the body of the identically keyed region in existing, if any.
+func preserveRegions(existing, generated string) (string, error) {
+	kept, err := parseRegions(existing)
+	if err != nil {
+		return "", fmt.Errorf("existing file: %w", err)
+	}
+	out := &strings.Builder{}
+	err = walkRegions(generated, func(line string, r *region) {
+		if r == nil {
+			out.WriteString(line)
+		} else if body, ok := kept[r.key]; ok {
+			out.WriteString(body)
+		} else {
+			out.WriteString(r.body)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,132 @@
+//go:build go1.25
+
+package scaffolder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// rootTarget is a target confined to a directory with os.Root, so that no
+// path, including one traversing a symlink, can resolve outside of it.
+type rootTarget struct {
+	root *os.Root
+	dir  string
+}
+
+var _ target = (*rootTarget)(nil)
+
+// openRootTarget creates the directory dir if necessary and returns a target
+// confined to it. The returned function closes the target.
+func openRootTarget(dir string) (target, func() error, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, &FSError{Op: "create directory", Path: dir, Err: err}
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, nil, &FSError{Op: "open destination", Path: dir, Err: err}
+	}
+	return &rootTarget{root: root, dir: dir}, root.Close, nil
+}
+
+// name returns path relative to the root.
+func (r *rootTarget) name(op, path string) (string, error) {
+	rel, err := filepath.Rel(r.dir, path)
+	if err != nil {
+		return "", &fs.PathError{Op: op, Path: path, Err: fmt.Errorf("not within %s", r.dir)}
+	}
+	return rel, nil
+}
+
+func (r *rootTarget) MkdirAll(path string, perm os.FileMode) error {
+	name, err := r.name("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return r.root.MkdirAll(name, perm)
+}
+
+func (r *rootTarget) ReadFile(path string) ([]byte, error) {
+	name, err := r.name("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.ReadFile(name)
+}
+
+func (r *rootTarget) ReadDir(path string) ([]fs.DirEntry, error) {
+	name, err := r.name("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadDir(r.root.FS(), filepath.ToSlash(name))
+}
+
+func (r *rootTarget) WriteFile(path string, data []byte, perm os.FileMode) error {
+	name, err := r.name("open", path)
+	if err != nil {
+		return err
+	}
+	return r.root.WriteFile(name, data, perm)
+}
+
+func (r *rootTarget) Chmod(path string, mode os.FileMode) error {
+	name, err := r.name("chmod", path)
+	if err != nil {
+		return err
+	}
+	return r.root.Chmod(name, mode)
+}
+
+func (r *rootTarget) Chtimes(path string, atime, mtime time.Time) error {
+	name, err := r.name("chtimes", path)
+	if err != nil {
+		return err
+	}
+	return r.root.Chtimes(name, atime, mtime)
+}
+
+func (r *rootTarget) Lchown(path string, uid, gid int) error {
+	name, err := r.name("lchown", path)
+	if err != nil {
+		return err
+	}
+	return r.root.Lchown(name, uid, gid)
+}
+
+// Symlink creates newname within the root. As with os.Root, oldname is not
+// validated, but the link can't subsequently be followed outside the root.
+func (r *rootTarget) Symlink(oldname, newname string) error {
+	name, err := r.name("symlink", newname)
+	if err != nil {
+		return err
+	}
+	return r.root.Symlink(oldname, name)
+}
+
+func (r *rootTarget) Remove(path string) error {
+	name, err := r.name("remove", path)
+	if err != nil {
+		return err
+	}
+	return r.root.Remove(name)
+}
+
+func (r *rootTarget) Stat(path string) (fs.FileInfo, error) {
+	name, err := r.name("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.Stat(name)
+}
+
+func (r *rootTarget) Lstat(path string) (fs.FileInfo, error) {
+	name, err := r.name("lstat", path)
+	if err != nil {
+		return nil, err
+	}
+	return r.root.Lstat(name)
+}
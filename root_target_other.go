@@ -0,0 +1,9 @@
+//go:build !go1.25
+
+package scaffolder
+
+import "errors"
+
+func openRootTarget(dir string) (target, func() error, error) {
+	return nil, nil, errors.New("ConfineTarget requires Go 1.25 or later")
+}
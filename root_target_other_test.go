@@ -0,0 +1,17 @@
+//go:build !go1.25
+
+package scaffolder_test
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+)
+
+func TestConfineTargetUnsupported(t *testing.T) {
+	src := writeTree(t, map[string]string{"file.txt": "content"})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.ConfineTarget())
+	assert.EqualError(t, err, "ConfineTarget requires Go 1.25 or later")
+}
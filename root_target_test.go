@@ -0,0 +1,55 @@
+//go:build go1.25
+
+package scaffolder_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+	"github.com/TBD54566975/scaffolder/scaffoldertest"
+)
+
+func TestConfineTargetBlocksTemplatedEscape(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}": "escaped",
+	})
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "../escaped.txt"}, scaffolder.ConfineTarget())
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(parent, "escaped.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConfineTargetBlocksSymlinkEscape(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"out/file.txt": "escaped",
+	})
+	parent := t.TempDir()
+	outside := filepath.Join(parent, "outside")
+	assert.NoError(t, os.Mkdir(outside, 0o700))
+	dest := filepath.Join(parent, "dest")
+	assert.NoError(t, os.Mkdir(dest, 0o700))
+	assert.NoError(t, os.Symlink("../outside", filepath.Join(dest, "out")))
+
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.ConfineTarget())
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(outside, "file.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConfineTarget(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}/file.txt": "hello",
+	})
+	dest := filepath.Join(t.TempDir(), "dest")
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "pkg"}, scaffolder.ConfineTarget())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "pkg/file.txt", Mode: 0o600, Content: "hello"},
+	})
+}
@@ -3,21 +3,100 @@
 package scaffolder
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"slices"
 	"strings"
+	"testing/fstest"
 	"text/template"
+	"time"
 )
 
-const recurseFuncName = "push"
+const (
+	recurseFuncName     = "push"
+	recurseFromFuncName = "pushFrom"
+	chmodFuncName       = "chmod"
+	includeFuncName     = "include"
+	tplFuncName         = "tpl"
+	scaffoldFuncName    = "scaffold"
+	isDryRunFuncName    = "isDryRun"
+	hasFeatureFuncName  = "hasFeature"
+
+	// noStripMarker is the name of a file that disables .tmpl suffix removal
+	// in the directory containing it and below.
+	noStripMarker = ".scaffolder-no-strip"
+
+	defaultMaxIncludeDepth = 32
+)
+
+// Builtin template functions that can't be overridden.
+var reservedFuncNames = []string{recurseFuncName, recurseFromFuncName, chmodFuncName, includeFuncName, tplFuncName, scaffoldFuncName}
+
+// IsReservedFunc reports whether name is a builtin template function, such as
+// push or include, that can't be overridden and is only defined while
+// scaffolding an entry.
+func IsReservedFunc(name string) bool {
+	return slices.Contains(reservedFuncNames, name)
+}
 
 type scaffoldOptions struct {
 	Config
-	plugins []Extension
+	plugins             []Extension
+	contextualFuncs     []func(cfg *Config) FuncMap
+	htmlEscape          bool
+	skipUnchanged       bool
+	followSymlinks      bool
+	maxFileSize         int64
+	executableShebang   bool
+	siblings            bool
+	rootExclude         []string
+	contentFilters      []func(path, content string) (string, error)
+	maxIncludeDepth     int
+	frontMatter         bool
+	forceMode           bool
+	confineTarget       bool
+	overwriteOnly       []string
+	protectedRegions    bool
+	excludeDotfiles     bool
+	excludeIf           []func(rel string, ctx any) (bool, error)
+	collect             bool
+	owner               *[2]int
+	manifestPath        string
+	overwriteUnmodified bool
+	modes               map[string]os.FileMode
+	platform            *[2]string
+	onComplete          []func(files []string) error
+	templateManifest    string
+	metrics             *Metrics
+	excludeTemplates    []string
+	onPlan              []func(total int)
+	features            map[string]bool
+	requireEmptyDest    bool
+	secrets             *secretValues
+	preserveTimes       bool
+	fixedTime           *time.Time
+	allowFunctions      map[string]bool
+	disallowedFuncs     map[string]bool
+	gitkeep             string
+	engine              Engine
+	record              *json.Encoder
+	maxDepth            int
+	isBinary            func(path string, head []byte) bool
+	random              *random
+	onSkip              []func(Skip)
+	// Errors from applying options, reported once all options are applied.
+	errs []error
 }
 
 // Extension's allow the scaffolder to be extended.
@@ -38,6 +117,78 @@ type AfterEachExtensionFunc func(path string) error
 func (f AfterEachExtensionFunc) Extend(mutableConfig *Config) error { return nil }
 func (f AfterEachExtensionFunc) AfterEach(path string) error        { return f(path) }
 
+// BaseExtension implements Extension with no-op methods.
+//
+// Embed it in a struct to implement only the methods an extension needs. The
+// struct's fields can then carry state between Extend, AfterEach and, by
+// implementing AfterAllExtension, AfterAll.
+type BaseExtension struct{}
+
+func (BaseExtension) Extend(mutableConfig *Config) error { return nil }
+func (BaseExtension) AfterEach(path string) error        { return nil }
+
+// AfterAllExtension is an optional interface that an Extension can implement
+// to be called once all files, directories and symlinks have been created.
+//
+// Files added with Config.AddFile from AfterAll are written after it returns.
+type AfterAllExtension interface {
+	Extension
+	AfterAll(cfg *Config) error
+}
+
+// RenderExtension is an optional interface that an Extension can implement to
+// wrap the rendering of the content of each file, eg. to time or cache it.
+//
+// WrapRender receives the function that would otherwise render the file and
+// returns its replacement. Wrappers compose in registration order, so the first
+// registered extension's wrapper is outermost.
+type RenderExtension interface {
+	Extension
+	WrapRender(next RenderFunc) RenderFunc
+}
+
+// EntryKind is the kind of filesystem entry created by the scaffolder.
+type EntryKind int
+
+const (
+	EntryFile EntryKind = iota
+	EntryDir
+	EntrySymlink
+)
+
+func (k EntryKind) String() string {
+	switch k {
+	case EntryFile:
+		return "file"
+	case EntryDir:
+		return "dir"
+	case EntrySymlink:
+		return "symlink"
+	default:
+		return fmt.Sprintf("EntryKind(%d)", int(k))
+	}
+}
+
+// EntryExtension is an optional interface that an Extension can implement to
+// receive the file info and kind of each created entry.
+//
+// If implemented, AfterEachEntry is called instead of AfterEach. Unlike
+// AfterEach, it is also called for symlinks, once they have been created.
+type EntryExtension interface {
+	Extension
+	AfterEachEntry(path string, info fs.FileInfo, kind EntryKind) error
+}
+
+// AfterEachEntryExtensionFunc is a convenience type for creating an
+// EntryExtension.AfterEachEntry from a function.
+type AfterEachEntryExtensionFunc func(path string, info fs.FileInfo, kind EntryKind) error
+
+func (f AfterEachEntryExtensionFunc) Extend(mutableConfig *Config) error { return nil }
+func (f AfterEachEntryExtensionFunc) AfterEach(path string) error        { return nil }
+func (f AfterEachEntryExtensionFunc) AfterEachEntry(path string, info fs.FileInfo, kind EntryKind) error {
+	return f(path, info, kind)
+}
+
 // Option is a function that modifies the behaviour of the scaffolder.
 type Option func(*scaffoldOptions)
 
@@ -53,22 +204,113 @@ type Config struct {
 	Funcs   FuncMap
 	Exclude []string
 
-	source string
-	target string
+	source    string
+	target    string
+	extra     *[]extraFile
+	renderers map[string]RenderFunc
+	dryRun    bool
+}
+
+type extraFile struct {
+	path    string
+	content []byte
+	mode    os.FileMode
 }
 
 func (c *Config) Source() string { return c.source }
 func (c *Config) Target() string { return c.target }
 
+// DryRun reports whether the DryRun option is in effect.
+func (c *Config) DryRun() bool { return c.dryRun }
+
+// AddFile registers an additional file to write to path, relative to the
+// destination, once all templates have been scaffolded.
+//
+// This allows extensions to emit auxiliary files, such as lockfiles or
+// manifests, and may be called from Extend or AfterEach. Extra files are
+// subject to Exclude patterns, matched against path, and it is an error for
+// an extra file to have the same path as a scaffolded file or another extra
+// file.
+func (c *Config) AddFile(path string, content []byte, mode os.FileMode) error {
+	if !filepath.IsLocal(path) {
+		return fmt.Errorf("%q is outside the destination directory", path)
+	}
+	*c.extra = append(*c.extra, extraFile{path: filepath.Clean(path), content: content, mode: mode})
+	return nil
+}
+
+// RenderFunc renders the content of the template file at path using ctx.
+type RenderFunc func(path, template string, ctx any) (string, error)
+
+// AddRenderer renders the content of files whose source name ends with suffix
+// using render rather than the Go template engine, and removes suffix from
+// the destination name. If several suffixes match, the longest is used.
+//
+// Path names are always evaluated as Go templates.
+func (c *Config) AddRenderer(suffix string, render RenderFunc) {
+	c.renderers[suffix] = render
+}
+
+// renderer returns the renderer for the source file at path and its suffix,
+// or nil if path is a Go template.
+func (c *Config) renderer(path string) (RenderFunc, string) {
+	var render RenderFunc
+	suffix := ""
+	for candidate, fn := range c.renderers {
+		if strings.HasSuffix(path, candidate) && len(candidate) > len(suffix) {
+			render, suffix = fn, candidate
+		}
+	}
+	return render, suffix
+}
+
 // Functions adds functions to use in scaffolding templates.
+//
+// Existing functions of the same name are replaced, with the exception of
+// the builtin functions push, pushFrom, chmod, include, tpl and scaffold,
+// which can't be overridden.
 func Functions(funcs FuncMap) Option {
 	return func(o *scaffoldOptions) {
 		for k, v := range funcs {
+			if slices.Contains(reservedFuncNames, k) {
+				o.errs = append(o.errs, fmt.Errorf("function %q is reserved and can't be overridden", k))
+				continue
+			}
+			o.Funcs[k] = v
+		}
+	}
+}
+
+// FunctionsStrict is like Functions but it is an error for any of funcs to
+// have the same name as an existing function.
+func FunctionsStrict(funcs FuncMap) Option {
+	return func(o *scaffoldOptions) {
+		for k, v := range funcs {
+			if slices.Contains(reservedFuncNames, k) {
+				o.errs = append(o.errs, fmt.Errorf("function %q is reserved and can't be overridden", k))
+				continue
+			}
+			if _, ok := o.Funcs[k]; ok {
+				o.errs = append(o.errs, fmt.Errorf("function %q is already defined", k))
+				continue
+			}
 			o.Funcs[k] = v
 		}
 	}
 }
 
+// ContextualFunctions adds functions to use in scaffolding templates that are
+// constructed from the finalised Config.
+//
+// fn is called after all options and extensions have been applied, so the
+// returned functions can close over cfg.Source(), cfg.Target() and
+// cfg.Context.
+func ContextualFunctions(fn func(cfg *Config) FuncMap) Option {
+	return func(so *scaffoldOptions) {
+		so.contextualFuncs = append(so.contextualFuncs, fn)
+	}
+}
+
 // Extend adds an Extension to the scaffolder.
 //
 // An extension can be used to add functions to the template context, to
@@ -88,207 +330,1943 @@ func Exclude(paths ...string) Option {
 	}
 }
 
-// AfterEach configures Scaffolder to call "after" for each file or directory
-// created.
+// ExcludeTemplates is like Exclude but each pattern is first evaluated as a Go
+// template against the context, so exclusions can depend on it, eg.
 //
-// Useful for setting file permissions, etc.
+//	{{ if not .Mobile }}^mobile{{ end }}
 //
-// Each AfterEach function is called in order.
-func AfterEach(after func(path string) error) Option {
+// Surrounding whitespace is trimmed from the result, and patterns that
+// evaluate to the empty string are ignored. The result is a regex, so
+// interpolated values should be escaped with regexQuote, eg.
+// {{ regexQuote .Name }}, since any metacharacters they contain would
+// otherwise change the pattern.
+//
+// Patterns are evaluated once, after extensions have been applied, and only
+// default, custom and extension functions are available.
+func ExcludeTemplates(patterns ...string) Option {
 	return func(so *scaffoldOptions) {
-		so.plugins = append(so.plugins, AfterEachExtensionFunc(after))
+		so.excludeTemplates = append(so.excludeTemplates, patterns...)
 	}
 }
 
-// Scaffold evaluates the scaffolding files at the given source using ctx, while
-// copying them into destination.
-func Scaffold(source, destination string, ctx any, options ...Option) error {
-	opts := scaffoldOptions{
-		Config: Config{
-			source:  source,
-			target:  destination,
-			Context: ctx,
-			Funcs: FuncMap{
-				recurseFuncName: func(name string, ctx any) (string, error) { panic("not implemented") },
-			},
-		},
-	}
-	for _, option := range options {
-		option(&opts)
+// DryRun evaluates all templates and runs all hooks as usual, but writes the
+// results to memory rather than to the destination, which is left untouched.
+//
+// Templates can check for a dry run with {{ if isDryRun }}, and extensions
+// with Config.DryRun, eg. to skip expensive work. As nothing is read from the
+// destination either, options that compare against existing files, such as
+// SkipUnchanged and WriteManifest, behave as if it were empty.
+func DryRun() Option {
+	return func(so *scaffoldOptions) {
+		so.dryRun = true
+		so.Funcs[isDryRunFuncName] = func() bool { return true }
 	}
+}
 
-	for _, plugin := range opts.plugins {
-		if err := plugin.Extend(&opts.Config); err != nil {
-			return fmt.Errorf("failed to extend scaffolder: %w", err)
+// Features enables the named optional features, which templates can check for
+// with hasFeature, eg. {{ if hasFeature "auth" }}auth.go{{ end }}.
+//
+// Features accumulate over multiple uses of the option.
+func Features(names ...string) Option {
+	return func(so *scaffoldOptions) {
+		if so.features == nil {
+			features := map[string]bool{}
+			so.features = features
+			so.Funcs[hasFeatureFuncName] = func(name string) bool { return features[name] }
+		}
+		for _, name := range names {
+			so.features[name] = true
 		}
 	}
+}
 
-	s := &state{
-		scaffoldOptions:  opts,
-		deferredSymlinks: map[string]string{},
+// RequireEmptyDest fails with ErrDestNotEmpty, before anything is written, if
+// the destination directory exists and is not empty.
+//
+// This guards against accidentally scaffolding a fresh project into a
+// populated directory, and makes options governing existing files, such as
+// OverwriteOnly, redundant.
+func RequireEmptyDest() Option {
+	return func(so *scaffoldOptions) {
+		so.requireEmptyDest = true
 	}
+}
 
-	if err := s.scaffold(source, destination, ctx); err != nil {
-		return fmt.Errorf("failed to scaffold: %w", err)
+// PreserveTimes sets the access and modification times of each generated file
+// to the modification time of its source file, rather than the time it was
+// written, eg. for reproducible builds and caching.
+//
+// Sources without modification times, such as some fs.FS implementations
+// passed to Render, use the Unix epoch instead. Directories and symlinks are
+// unaffected. PreserveTimes can't be combined with FixedTime.
+func PreserveTimes() Option {
+	return func(so *scaffoldOptions) {
+		so.preserveTimes = true
 	}
+}
 
-	for dstPath := range s.deferredSymlinks {
-		if err := s.applySymlinks(dstPath); err != nil {
-			return fmt.Errorf("failed to apply symlink: %w", err)
+// Gitkeep writes an empty ".gitkeep" file into each generated directory that
+// would otherwise be empty, so that it is preserved by version control. See
+// GitkeepName to use a different name.
+//
+// Directories that already contain files, including those that existed before
+// scaffolding, are left as they are.
+func Gitkeep() Option {
+	return GitkeepName(".gitkeep")
+}
+
+// GitkeepName is like Gitkeep, but names the placeholder file name.
+func GitkeepName(name string) Option {
+	return func(so *scaffoldOptions) {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			so.errs = append(so.errs, fmt.Errorf("invalid gitkeep file name %q", name))
+			return
 		}
+		so.gitkeep = name
 	}
-	return nil
 }
 
-type state struct {
-	scaffoldOptions
-	deferredSymlinks map[string]string
+// FixedTime sets the access and modification times of every generated file and
+// directory, and of the manifest written by WriteManifest, to t once
+// scaffolding is complete, so that output is reproducible, eg. for
+// content-addressed packaging with ScaffoldArchive.
+//
+// The times of symlinks themselves are unchanged, as are those of the
+// destination directory. FixedTime and PreserveTimes are mutually exclusive.
+func FixedTime(t time.Time) Option {
+	return func(so *scaffoldOptions) {
+		so.fixedTime = &t
+	}
 }
 
-func (s *state) scaffold(srcDir, dstDir string, ctx any) error {
-	entries, err := os.ReadDir(srcDir)
-	if err != nil {
-		return err
+// AllowFunctions restricts templates to the named functions, for running
+// untrusted templates. All other functions, including builtins such as
+// include and those added by Functions and extensions, are removed, and
+// calling one is an error.
+//
+// Functions predefined by text/template, such as len and printf, are always
+// available. Code run by extensions themselves, such as JavaScript, is not
+// restricted.
+func AllowFunctions(names ...string) Option {
+	return func(so *scaffoldOptions) {
+		if so.allowFunctions == nil {
+			so.allowFunctions = map[string]bool{}
+		}
+		for _, name := range names {
+			so.allowFunctions[name] = true
+		}
 	}
-	if err := os.Mkdir(dstDir, 0700); err != nil && !os.IsExist(err) {
-		return fmt.Errorf("failed to create directory: %w", err)
+}
+
+// HTMLEscape evaluates the content of files with a .html or .htm extension
+// using html/template, which applies contextual auto-escaping.
+//
+// All other files, and all path names, continue to be evaluated with
+// text/template.
+func HTMLEscape() Option {
+	return func(so *scaffoldOptions) {
+		so.htmlEscape = true
 	}
-nextEntry:
-	for _, entry := range entries {
-		srcPath := filepath.Join(srcDir, entry.Name())
-		relPath, _ := filepath.Rel(s.source, srcPath) // Can't fail.
-		for _, exclude := range s.Exclude {
-			if matched, err := regexp.MatchString(exclude, relPath); err != nil {
-				return fmt.Errorf("invalid exclude pattern %q: %w", exclude, err)
-			} else if matched {
-				continue nextEntry
-			}
-		}
-		funcs := maps.Clone(s.Funcs)
+}
 
-		// Add a recursive function that can be used to recurse into subcontexts for files and directories.
-		recursiveContext := map[string]any{}
-		funcs[recurseFuncName] = func(name string, ctx any) string {
-			recursiveContext[name] = ctx
-			return name + "\000"
-		}
-		dstName, err := evaluate(srcPath, entry.Name(), ctx, funcs)
-		if err != nil {
-			return fmt.Errorf("failed to evaluate path name %q: %w", filepath.Join(dstDir, entry.Name()), err)
-		}
-		if dstName == "" {
-			continue
-		}
+// SkipUnchanged skips writing files whose rendered content is identical to
+// the existing file in the destination.
+//
+// Skipped files retain their modification time, and AfterEach is not called
+// for them.
+func SkipUnchanged() Option {
+	return func(so *scaffoldOptions) {
+		so.skipUnchanged = true
+	}
+}
 
-		dstPath := filepath.Join(dstDir, dstName)
-		dstPath = strings.TrimSuffix(dstPath, ".tmpl")
+// FollowSourceSymlinks dereferences symlinks in the source tree, copying the
+// files and directories they point to rather than recreating the links.
+//
+// Symlinks that would result in a cycle are reported as an error.
+func FollowSourceSymlinks() Option {
+	return func(so *scaffoldOptions) {
+		so.followSymlinks = true
+	}
+}
 
-		info, err := entry.Info()
-		if err != nil {
-			return fmt.Errorf("failed to get file info: %w", err)
-		}
+// MaxFileSize aborts scaffolding if the rendered content of any single file
+// exceeds the given number of bytes.
+//
+// This guards against runaway templates, particularly from untrusted sources.
+func MaxFileSize(bytes int64) Option {
+	return func(so *scaffoldOptions) {
+		so.maxFileSize = bytes
+	}
+}
 
-		if len(recursiveContext) == 0 {
-			if err := s.scaffoldEntry(info, srcPath, dstPath, ctx, funcs); err != nil {
-				return err
-			}
-		}
-		for subEntry, subCtx := range recursiveContext {
-			if err := s.scaffoldEntry(info, srcPath, filepath.Join(dstDir, subEntry), subCtx, funcs); err != nil {
-				return err
-			}
+// binaryHeadSize is the number of bytes at the start of a file passed to the
+// IsBinary predicate.
+const binaryHeadSize = 512
+
+// IsBinary replaces the heuristic used to detect binary files, which are
+// copied verbatim rather than evaluated as templates.
+//
+// isBinary is called with the path of each regular file relative to the
+// source and up to its first 512 bytes. By default, files containing a NUL
+// byte in their first 512 bytes are binary.
+func IsBinary(isBinary func(path string, head []byte) bool) Option {
+	return func(so *scaffoldOptions) {
+		if isBinary == nil {
+			so.errs = append(so.errs, errors.New("IsBinary requires a predicate"))
+			return
 		}
+		so.isBinary = isBinary
 	}
-	return nil
 }
 
-func (s *state) scaffoldEntry(info fs.FileInfo, srcPath, dstPath string, ctx any, funcs template.FuncMap) error {
-	switch {
-	case info.Mode()&os.ModeSymlink != 0:
-		target, err := os.Readlink(srcPath)
-		if err != nil {
-			return fmt.Errorf("failed to read symlink: %w", err)
-		}
+// hasNUL is the default IsBinary heuristic.
+func hasNUL(path string, head []byte) bool {
+	return bytes.IndexByte(head, 0) >= 0
+}
 
-		target, err = evaluate(srcPath, target, ctx, funcs)
-		if err != nil {
-			return fmt.Errorf("failed to evaluate symlink target: %w", err)
+// ExecutableShebang makes rendered files whose content begins with "#!"
+// executable, regardless of the mode of the source file.
+//
+// Execute permission is granted to each of user, group and other that has
+// read permission, so a 0644 file becomes 0755.
+func ExecutableShebang() Option {
+	return func(so *scaffoldOptions) {
+		so.executableShebang = true
+	}
+}
+
+// Siblings makes a "siblings" function available to file content templates,
+// returning the sorted names of the other files and directories generated in
+// the same destination directory.
+//
+// This is useful for generating index or manifest files. It requires an
+// additional pass over the source tree to evaluate every path name before any
+// content is rendered, so path name templates are evaluated twice.
+func Siblings() Option {
+	return func(so *scaffoldOptions) {
+		so.siblings = true
+	}
+}
+
+// TemplateManifest reads template metadata from the YAML file name, relative
+// to the root of the template, eg. "scaffolder.yaml". The manifest itself is
+// not scaffolded, and a missing manifest is ignored.
+//
+// A manifest may declare a parent template to inherit from:
+//
+//	extends: ../base
+//
+// The parent, a path relative to the template root or the HTTP(S) URL of a
+// template archive, is scaffolded into the destination first, and the files
+// of the child template then override those of the parent. Parents may in
+// turn extend other templates, and cycles are an error. Exclude patterns are
+// matched relative to the root of each template.
+//
+// A manifest may also declare file modes by glob pattern, which are applied
+// after writing as for ApplyModes:
+//
+//	modes:
+//	  scripts/*: 0755
+//
+// Modes from ApplyModes take precedence over those of the same pattern in a
+// manifest, and those of a child template over those of its parent.
+func TemplateManifest(name string) Option {
+	return func(so *scaffoldOptions) {
+		if !filepath.IsLocal(name) {
+			so.errs = append(so.errs, fmt.Errorf("template manifest %q is outside the template directory", name))
+			return
 		}
+		so.templateManifest = name
+	}
+}
 
-		// Ensure symlink is relative.
-		if filepath.IsAbs(target) {
-			rel, err := filepath.Rel(filepath.Dir(dstPath), target)
-			if err != nil {
-				return fmt.Errorf("failed to make symlink relative: %w", err)
-			}
-			target = rel
+// Owner sets the user and group ID of each scaffolded file, directory and
+// symlink, which usually requires elevated privileges.
+//
+// Ownership is set before AfterEach hooks run. It is a no-op on Windows.
+func Owner(uid, gid int) Option {
+	return func(so *scaffoldOptions) {
+		so.owner = &[2]int{uid, gid}
+	}
+}
+
+// WriteManifest writes a JSON manifest of the regular files generated by a
+// successful run, with their SHA-256 hashes, to path relative to the
+// destination. Paths in the manifest are relative to its directory.
+//
+// The manifest can be passed to Clean to remove the generated files.
+func WriteManifest(path string) Option {
+	return func(so *scaffoldOptions) {
+		if !filepath.IsLocal(path) {
+			so.errs = append(so.errs, fmt.Errorf("manifest %q is outside the destination directory", path))
+			return
 		}
+		so.manifestPath = path
+	}
+}
 
-		s.deferredSymlinks[dstPath] = target
+// OverwriteUnmodified only overwrites existing files whose content matches the
+// hash recorded by WriteManifest in the previous run, which must also be
+// enabled.
+//
+// Files that have been edited since they were generated, or that were not
+// generated by the previous run, are left untouched. Edited files keep their
+// previously generated hash in the new manifest so they remain protected on
+// subsequent runs.
+func OverwriteUnmodified() Option {
+	return func(so *scaffoldOptions) {
+		so.overwriteUnmodified = true
+	}
+}
 
-	case info.Mode().IsDir():
-		if err := os.MkdirAll(dstPath, 0700); err != nil {
-			return fmt.Errorf("failed to create directory: %w", err)
+// ApplyModes sets the mode of generated regular files once all files have been
+// written, where each key of modes is a glob pattern matched against the
+// destination-relative path as for OverwriteOnly, eg. {"*.sh": 0755}.
+//
+// If several patterns match a file, the longest is used, with ties going to
+// the lexically first. Modes are applied exactly, overriding source modes and
+// chmod directives.
+func ApplyModes(modes map[string]os.FileMode) Option {
+	return func(so *scaffoldOptions) {
+		if so.modes == nil {
+			so.modes = map[string]os.FileMode{}
 		}
-		for _, plugin := range s.plugins {
-			if err := plugin.AfterEach(dstPath); err != nil {
-				return fmt.Errorf("failed to run after: %w", err)
+		for pattern, mode := range modes {
+			if _, err := path.Match(pattern, ""); err != nil {
+				so.errs = append(so.errs, fmt.Errorf("invalid mode pattern %q: %w", pattern, err))
+				continue
 			}
+			so.modes[pattern] = mode
 		}
-		return s.scaffold(srcPath, dstPath, ctx)
+	}
+}
 
-	case info.Mode().IsRegular():
-		template, err := os.ReadFile(srcPath)
-		if err != nil {
-			return fmt.Errorf("failed to read file: %w", err)
-		}
-		content, err := evaluate(srcPath, string(template), ctx, funcs)
-		if err != nil {
-			return fmt.Errorf("%s: failed to evaluate template: %w", srcPath, err)
-		}
-		err = os.WriteFile(dstPath, []byte(content), info.Mode())
-		if err != nil {
-			return fmt.Errorf("failed to write file: %w", err)
+// Platform enables platform-specific files and directories, whose names end
+// with ".goos-<os>" or ".goarch-<arch>", eg. "Makefile.goos-windows" or
+// "Makefile.goos-windows.tmpl".
+//
+// Entries for other platforms are excluded, and the suffixes are removed from
+// the names of matching entries. Suffixes can be combined, as in
+// "run.goos-linux.goarch-arm64". An empty goos or goarch selects
+// runtime.GOOS or runtime.GOARCH respectively.
+func Platform(goos, goarch string) Option {
+	return func(so *scaffoldOptions) {
+		if goos == "" {
+			goos = runtime.GOOS
 		}
-		for _, plugin := range s.plugins {
-			if err := plugin.AfterEach(dstPath); err != nil {
-				return fmt.Errorf("failed to run after: %w", err)
-			}
+		if goarch == "" {
+			goarch = runtime.GOARCH
 		}
+		so.platform = &[2]string{goos, goarch}
+	}
+}
 
-	default:
-		return fmt.Errorf("%s: unsupported file type %s", srcPath, info.Mode())
+// OnComplete calls complete once all files and symlinks have been written,
+// with the sorted destination-relative paths of every generated entry.
+//
+// This is the place for whole-tree post-processing, such as generating an
+// index or running a formatter. An error from complete fails the scaffold.
+func OnComplete(complete func(files []string) error) Option {
+	return func(so *scaffoldOptions) {
+		so.onComplete = append(so.onComplete, complete)
 	}
-	return nil
 }
 
-// Recursively apply symlinks.
-func (s *state) applySymlinks(path string) error {
-	target, ok := s.deferredSymlinks[path]
-	if !ok {
-		return nil
+// OnPlan calls plan with the number of files, directories and symlinks that
+// will be scaffolded, before any are written, eg. to display progress along
+// with AfterEachEntry.
+//
+// Like Siblings, this requires an additional pass over the source tree to
+// evaluate every path name. Files added by extensions with Config.AddFile are
+// not included in the total.
+func OnPlan(plan func(total int)) Option {
+	return func(so *scaffoldOptions) {
+		so.onPlan = append(so.onPlan, plan)
 	}
-	targetPath := filepath.Clean(filepath.Join(filepath.Dir(path), target))
-	if err := s.applySymlinks(targetPath); err != nil {
-		return fmt.Errorf("failed to apply symlink: %w", err)
+}
+
+// Collect enables two-pass scaffolding with "collect" and "collected"
+// functions, for generating files that reference the full set of something,
+// such as a central registry of models.
+//
+// In the first pass only path names are evaluated, and {{ collect "key" value }}
+// in a path name appends value to the list for key, rendering as the empty
+// string. In the second pass, which scaffolds as usual, collect does nothing
+// and {{ collected "key" }} returns the values collected for key in the first
+// pass. As with Siblings, path name templates are evaluated twice.
+func Collect() Option {
+	return func(so *scaffoldOptions) {
+		so.collect = true
 	}
-	delete(s.deferredSymlinks, path)
-	err := os.Remove(path)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to remove symlink target: %w", err)
+}
+
+// ExcludeIf excludes source entries for which fn returns true.
+//
+// fn is called for each file and directory before its name is evaluated, with
+// its path relative to the source root, as for Exclude, and the context in
+// effect for it. Excluding a directory excludes its entire subtree.
+func ExcludeIf(fn func(rel string, ctx any) (bool, error)) Option {
+	return func(so *scaffoldOptions) {
+		so.excludeIf = append(so.excludeIf, fn)
 	}
-	return os.Symlink(target, path)
 }
 
-func evaluate(path, tmpl string, ctx any, funcs template.FuncMap) (string, error) {
-	t, err := template.New(path).Funcs(funcs).Parse(tmpl)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
+// IncludeDotfiles controls whether source files and directories whose names
+// begin with "." are scaffolded. The default is true.
+//
+// When false, such entries are skipped during traversal, before template
+// evaluation, so local clutter like .DS_Store or .git is not copied.
+func IncludeDotfiles(include bool) Option {
+	return func(so *scaffoldOptions) {
+		so.excludeDotfiles = !include
 	}
-	newName := &strings.Builder{}
-	err = t.Execute(newName, ctx)
-	if err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
+}
+
+// RootExclude excludes entries at the top level of the source that match any
+// of the given glob patterns, as understood by filepath.Match.
+//
+// Unlike Exclude, identically named entries in subdirectories are not
+// affected. Matching occurs before template evaluation and .tmpl suffix
+// removal.
+func RootExclude(patterns ...string) Option {
+	return func(so *scaffoldOptions) {
+		so.rootExclude = append(so.rootExclude, patterns...)
+	}
+}
+
+// ContentFilter adds a filter that post-processes the rendered content of each
+// regular file before it is written.
+//
+// filter receives the destination path and rendered content, and returns the
+// content to write. Filters are applied in the order they are registered.
+func ContentFilter(filter func(path, content string) (string, error)) Option {
+	return func(so *scaffoldOptions) {
+		so.contentFilters = append(so.contentFilters, filter)
+	}
+}
+
+// Transform adds a content filter that post-processes the rendered content of
+// each regular file whose destination-relative path matches the glob pattern,
+// such as running a formatter over "*.go" files.
+//
+// Patterns are matched as for OverwriteOnly. Transforms and content filters
+// are applied in the order they are registered.
+func Transform(pattern string, fn func(content string) (string, error)) Option {
+	return func(so *scaffoldOptions) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			so.errs = append(so.errs, fmt.Errorf("invalid transform pattern %q: %w", pattern, err))
+			return
+		}
+		target := so.target
+		so.contentFilters = append(so.contentFilters, func(dstPath, content string) (string, error) {
+			rel, err := filepath.Rel(target, dstPath)
+			if err != nil || !matchPath(pattern, rel) {
+				return content, nil
+			}
+			return fn(content)
+		})
+	}
+}
+
+// MaxIncludeDepth sets the maximum nesting depth of the "include" and "tpl"
+// functions, which defaults to 32.
+//
+// Templates may include themselves, eg. to walk a tree, as long as the
+// recursion is bounded by the data. Exceeding the limit, eg. because two
+// templates include each other unconditionally, is an error that reports the
+// chain of includes.
+func MaxIncludeDepth(n int) Option {
+	return func(so *scaffoldOptions) {
+		so.maxIncludeDepth = n
+	}
+}
+
+// MaxDepth skips entries more than n directories deep in the source, eg. with
+// MaxDepth(1) only the top-level files and directories are scaffolded, and
+// the directories are empty.
+//
+// Depth is relative to the root of the template, or of the subtree being
+// scaffolded by pushFrom.
+func MaxDepth(n int) Option {
+	return func(so *scaffoldOptions) {
+		if n < 1 {
+			so.errs = append(so.errs, fmt.Errorf("MaxDepth must be at least 1 but got %d", n))
+			return
+		}
+		so.maxDepth = n
+	}
+}
+
+// FrontMatter enables YAML front matter in file content templates.
+//
+// If a file begins with a block delimited by "---" lines, the block is parsed
+// as YAML and stripped from the output. Its values are merged into the
+// context used to render the rest of that file, taking precedence over
+// fields of the same name in the context. The context must be nil, a map with
+// string keys, or a struct.
+func FrontMatter() Option {
+	return func(so *scaffoldOptions) {
+		so.frontMatter = true
+	}
+}
+
+// OverwriteOnly preserves files that already exist in the destination unless
+// their destination-relative path matches one of the given glob patterns, as
+// understood by path.Match with "/" separators.
+//
+// A pattern without a "/" is matched against the file name alone, so "*_gen.go"
+// matches generated files in any directory. With no patterns, no existing file
+// is overwritten.
+func OverwriteOnly(patterns ...string) Option {
+	return func(so *scaffoldOptions) {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				so.errs = append(so.errs, fmt.Errorf("invalid overwrite pattern %q: %w", pattern, err))
+			}
+		}
+		if so.overwriteOnly == nil {
+			so.overwriteOnly = []string{}
+		}
+		so.overwriteOnly = append(so.overwriteOnly, patterns...)
+	}
+}
+
+// ProtectedRegions preserves hand-edited regions of existing files when
+// scaffolding over them.
+//
+// A region begins with a line containing "scaffolder:keep" and ends with a line
+// containing "scaffolder:end", typically inside comments. The lines between
+// the markers are taken from the existing file rather than the template.
+// Any text after "scaffolder:keep", less a trailing comment closer such as
+// "-->" or "*/", names the region; names must be unique, and unnamed regions
+// are matched by their order in the file. Generated regions with no
+// counterpart in the existing file keep their templated content.
+func ProtectedRegions() Option {
+	return func(so *scaffoldOptions) {
+		so.protectedRegions = true
+	}
+}
+
+// ForceMode sets the mode of each generated file to exactly its intended mode
+// after writing it, so that the result is not affected by the process umask
+// or the mode of an existing file.
+func ForceMode() Option {
+	return func(so *scaffoldOptions) {
+		so.forceMode = true
+	}
+}
+
+// ConfineTarget performs all writes to the destination through an os.Root
+// opened at it, so that neither templated paths nor symlinks, including those
+// already present in the destination, can cause writes outside of it.
+//
+// It requires Go 1.25 or later. There is no fallback when built with an earlier
+// version: scaffolding returns an error rather than writing to the destination
+// unconfined.
+func ConfineTarget() Option {
+	return func(so *scaffoldOptions) {
+		so.confineTarget = true
+	}
+}
+
+// AfterEach configures Scaffolder to call "after" for each file or directory
+// created.
+//
+// Useful for setting file permissions, etc.
+//
+// Each AfterEach function is called in order.
+func AfterEach(after func(path string) error) Option {
+	return func(so *scaffoldOptions) {
+		so.plugins = append(so.plugins, AfterEachExtensionFunc(after))
+	}
+}
+
+// AfterEachEntry is like AfterEach but "after" also receives the file info of
+// the created entry and its kind, and is additionally called for symlinks.
+func AfterEachEntry(after func(path string, info fs.FileInfo, kind EntryKind) error) Option {
+	return func(so *scaffoldOptions) {
+		so.plugins = append(so.plugins, AfterEachEntryExtensionFunc(after))
+	}
+}
+
+// Scaffold evaluates the scaffolding files at the given source using ctx, while
+// copying them into destination.
+//
+// Existing directories in the destination, including symlinks to directories,
+// are reused as is. Files are written through symlinked directories rather
+// than replacing the link.
+func Scaffold(source, destination string, ctx any, options ...Option) error {
+	return ScaffoldContext(context.Background(), source, destination, ctx, options...)
+}
+
+// ScaffoldContext is like Scaffold but aborts when cancelCtx is cancelled,
+// returning the context's error.
+//
+// Cancellation is checked between each file and directory.
+func ScaffoldContext(cancelCtx context.Context, source, destination string, ctx any, options ...Option) error {
+	return run(cancelCtx, osFS{}, source, osFS{}, destination, ctx, options)
+}
+
+// ScaffoldFile evaluates the single template file source using ctx, writing
+// the result to destination.
+//
+// The same functions, options and extensions as Scaffold apply, with
+// Config.Source() and Config.Target() being the directories containing source
+// and destination respectively. A .tmpl suffix is removed from destination.
+//
+// As the file is added to an existing directory, RequireEmptyDest fails only
+// if destination itself exists, and WriteManifest updates the entry for
+// destination in any existing manifest rather than replacing it. No path names
+// are evaluated, so collect records nothing and siblings is always empty.
+func ScaffoldFile(source, destination string, ctx any, options ...Option) error {
+	opts, err := newOptions(osFS{}, filepath.Dir(source), filepath.Dir(destination), ctx, options)
+	if err != nil {
+		return err
+	}
+	destination = strings.TrimSuffix(destination, ".tmpl")
+	if opts.requireEmptyDest {
+		if _, err := os.Lstat(destination); err == nil {
+			return fmt.Errorf("%s: %w, file already exists", destination, ErrDestNotEmpty)
+		}
+	}
+	dst, closeTarget, err := openTarget(osFS{}, opts.target, opts)
+	if err != nil {
+		return err
+	}
+	defer closeTarget()
+	s := newState(context.Background(), osFS{}, dst, opts)
+	s.mergeManifest = true
+	if err := s.readPreviousManifest(); err != nil {
+		return err
+	}
+	info, err := s.src.Stat(source)
+	if err != nil {
+		return &FSError{Op: "stat file", Path: source, Err: err}
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", source)
+	}
+	scaffoldFile := func() error {
+		if !s.planning {
+			if err := s.ensureDir(s.target); err != nil {
+				return err
+			}
+		}
+		funcs := s.entryFuncs(filepath.Base(source), s.target)
+		return s.scaffoldEntry(info, source, destination, ctx, funcs)
+	}
+	if err := s.plan(scaffoldFile); err != nil {
+		return fmt.Errorf("failed to scaffold: %w", err)
+	}
+	if err := scaffoldFile(); err != nil {
+		return fmt.Errorf("failed to scaffold: %w", err)
+	}
+	return s.finish()
+}
+
+// Render evaluates the scaffolding files in source using ctx, returning the
+// rendered output as an in-memory fs.FS without touching disk.
+//
+// Symlinks in source are only supported if source implements
+// ReadLink(name string) (string, error). Symlinks in the output are
+// represented as entries with fs.ModeSymlink whose content is the link target.
+//
+// Paths passed to AfterEach hooks are relative to the root of the returned
+// fs.FS, and Config.Source() and Config.Target() are both ".".
+func Render(source fs.FS, ctx any, options ...Option) (fs.FS, error) {
+	dst := &memTarget{files: fstest.MapFS{}}
+	if err := run(context.Background(), fsSource{fsys: source}, ".", dst, ".", ctx, options); err != nil {
+		return nil, err
+	}
+	return dst.files, nil
+}
+
+func run(cancelCtx context.Context, src source, source string, dst target, destination string, ctx any, options []Option) error {
+	opts, err := newOptions(src, source, destination, ctx, options)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := dst.(osFS); ok && opts.requireEmptyDest {
+		if err := requireEmpty(destination); err != nil {
+			return err
+		}
+	}
+	dst, closeTarget, err := openTarget(dst, destination, opts)
+	if err != nil {
+		return err
+	}
+	defer closeTarget()
+
+	s := newState(cancelCtx, src, dst, opts)
+	if err := s.readPreviousManifest(); err != nil {
+		return err
+	}
+
+	templates := []string{source}
+	if s.templateManifest != "" {
+		chain, cleanup, err := s.templateChain(source)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		templates = chain
+	}
+
+	scaffoldTemplates := func() error { return s.scaffoldTemplates(templates, destination, ctx) }
+	if err := s.plan(scaffoldTemplates); err != nil {
+		return fmt.Errorf("failed to scaffold: %w", err)
+	}
+	if err := scaffoldTemplates(); err != nil {
+		return fmt.Errorf("failed to scaffold: %w", err)
+	}
+	return s.finish()
+}
+
+// sortedSymlinks returns the destination paths of the deferred symlinks in
+// sorted order, so that they are applied in a stable order, eg. for RecordTo.
+func (s *state) sortedSymlinks() []string {
+	symlinks := make([]string, 0, len(s.deferredSymlinks))
+	for dstPath := range s.deferredSymlinks {
+		symlinks = append(symlinks, dstPath)
+	}
+	slices.Sort(symlinks)
+	return symlinks
+}
+
+// openTarget returns the target to scaffold destination through in place of
+// dst, applying DryRun and ConfineTarget if dst is the real filesystem. The
+// returned function releases the target once scaffolding is complete.
+func openTarget(dst target, destination string, opts scaffoldOptions) (target, func() error, error) {
+	if _, ok := dst.(osFS); !ok {
+		return dst, func() error { return nil }, nil
+	}
+	if opts.dryRun {
+		return &memTarget{files: fstest.MapFS{}}, func() error { return nil }, nil
+	}
+	if opts.confineTarget {
+		return openRootTarget(destination)
+	}
+	return dst, func() error { return nil }, nil
+}
+
+// plan runs scaffold as a planning pass, if an option needs the full set of
+// entries before anything is generated.
+func (s *state) plan(scaffold func() error) error {
+	if !s.siblings && !s.collect && len(s.onPlan) == 0 {
+		return nil
+	}
+	s.planning = true
+	s.planned = map[string][]string{}
+	if err := scaffold(); err != nil {
+		return err
+	}
+	s.planning = false
+	s.deferredSymlinks = map[string]string{}
+	total := 0
+	for _, names := range s.planned {
+		total += len(names)
+	}
+	for _, plan := range s.onPlan {
+		plan(total)
+	}
+	return nil
+}
+
+// finish creates the deferred symlinks and applies the remaining steps that
+// follow scaffolding the entries.
+func (s *state) finish() error {
+	for _, dstPath := range s.sortedSymlinks() {
+		if err := s.applySymlinks(dstPath); err != nil {
+			return fmt.Errorf("failed to apply symlink: %w", err)
+		}
+	}
+
+	if err := s.afterAll(); err != nil {
+		return err
+	}
+	if err := s.writeExtraFiles(); err != nil {
+		return err
+	}
+	if err := s.writeGitkeeps(); err != nil {
+		return err
+	}
+	if err := s.applyModes(); err != nil {
+		return err
+	}
+	if err := s.writeManifest(); err != nil {
+		return err
+	}
+	if err := s.applyFixedTime(); err != nil {
+		return err
+	}
+	return s.complete()
+}
+
+// requireEmpty returns ErrDestNotEmpty, listing the first few entries, if dir
+// exists and is not empty.
+func requireEmpty(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return &FSError{Op: "read destination", Path: dir, Err: err}
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	const maxListed = 3
+	names := []string{}
+	for _, entry := range entries[:min(len(entries), maxListed)] {
+		names = append(names, entry.Name())
+	}
+	list := strings.Join(names, ", ")
+	if len(entries) > maxListed {
+		list += fmt.Sprintf(" and %d more", len(entries)-maxListed)
+	}
+	return fmt.Errorf("%s: %w, contains %s", dir, ErrDestNotEmpty, list)
+}
+
+// ListFunctions returns the sorted names of all functions available to
+// templates in source, including those contributed by extensions.
+func ListFunctions(source string, ctx any, options ...Option) ([]string, error) {
+	opts, err := newOptions(osFS{}, source, "", ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(opts.Funcs))
+	for name := range opts.Funcs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Lint evaluates every path name and file in source against ctx, returning
+// all errors encountered rather than stopping at the first.
+//
+// Nothing is written to disk.
+func Lint(source string, ctx any, options ...Option) []error {
+	opts, err := newOptions(osFS{}, source, ".", ctx, options)
+	if err != nil {
+		return []error{err}
+	}
+	s := newState(context.Background(), osFS{}, &memTarget{files: fstest.MapFS{}}, opts)
+	s.lint = true
+	templates := []string{source}
+	if s.templateManifest != "" {
+		chain, cleanup, err := s.templateChain(source)
+		if err != nil {
+			return []error{err}
+		}
+		defer cleanup()
+		templates = chain
+	}
+	if err := s.scaffoldTemplates(templates, ".", ctx); err != nil {
+		s.errs = append(s.errs, err)
+	}
+	for _, dstPath := range s.sortedSymlinks() {
+		if err := s.applySymlinks(dstPath); err != nil {
+			s.errs = append(s.errs, fmt.Errorf("failed to apply symlink: %w", err))
+		}
+	}
+	return s.errs
+}
+
+// excluded returns true if relPath, relative to the source root, matches any
+// of the exclude patterns.
+func (o *scaffoldOptions) excluded(relPath string) (bool, error) {
+	for _, exclude := range o.Exclude {
+		if matched, err := regexp.MatchString(exclude, relPath); err != nil {
+			return false, &ExcludeError{Pattern: exclude, Err: err}
+		} else if matched {
+			return true, nil
+		}
+	}
+	if !strings.ContainsRune(relPath, filepath.Separator) {
+		for _, exclude := range o.rootExclude {
+			if matched, err := filepath.Match(exclude, relPath); err != nil {
+				return false, &ExcludeError{Pattern: exclude, Err: err}
+			} else if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// excludedIf returns true if any ExcludeIf function excludes relPath with ctx.
+func (o *scaffoldOptions) excludedIf(relPath string, ctx any) (bool, error) {
+	for _, fn := range o.excludeIf {
+		if excluded, err := fn(relPath, ctx); err != nil {
+			return false, fmt.Errorf("%s: failed to evaluate exclusion: %w", relPath, err)
+		} else if excluded {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// newOptions applies options and extensions to create the final
+// configuration for a scaffolding run.
+func newOptions(src source, source, destination string, ctx any, options []Option) (scaffoldOptions, error) {
+	opts := scaffoldOptions{
+		Config: Config{
+			source:    source,
+			target:    destination,
+			Context:   ctx,
+			Funcs:     defaultFuncs(),
+			extra:     &[]extraFile{},
+			renderers: map[string]RenderFunc{},
+		},
+	}
+	opts.Funcs[recurseFuncName] = func(name string, ctx any) (string, error) { panic("not implemented") }
+	opts.Funcs[recurseFromFuncName] = func(name, subtree string, ctx any) (string, error) { panic("not implemented") }
+	opts.Funcs[chmodFuncName] = func(mode int) (string, error) { panic("not implemented") }
+	opts.Funcs[includeFuncName] = func(name string, ctx any) (string, error) { panic("not implemented") }
+	opts.Funcs[tplFuncName] = func(text string, ctx any) (string, error) { panic("not implemented") }
+	opts.Funcs[scaffoldFuncName] = func(name string, ctx any) (string, error) { panic("not implemented") }
+	opts.Funcs["dataFile"] = dataFileFunc(src, source)
+	opts.Funcs["sourceRoot"] = func() string { return source }
+	opts.Funcs["destRoot"] = func() string { return destination }
+	opts.secrets = &secretValues{}
+	opts.Funcs[secretFuncName] = secretFunc(nil, opts.secrets)
+	opts.Funcs[isDryRunFuncName] = func() bool { return false }
+	opts.Funcs[hasFeatureFuncName] = func(name string) bool { return false }
+	opts.maxIncludeDepth = defaultMaxIncludeDepth
+	opts.engine = textEngine{}
+	opts.isBinary = hasNUL
+	opts.random = &random{}
+	opts.Funcs["randPort"] = opts.random.randPort
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.overwriteUnmodified && opts.manifestPath == "" {
+		opts.errs = append(opts.errs, errors.New("OverwriteUnmodified requires WriteManifest"))
+	}
+	if opts.preserveTimes && opts.fixedTime != nil {
+		opts.errs = append(opts.errs, errors.New("FixedTime and PreserveTimes are mutually exclusive"))
+	}
+	if err := errors.Join(opts.errs...); err != nil {
+		return opts, err
+	}
+
+	for _, plugin := range opts.plugins {
+		if err := plugin.Extend(&opts.Config); err != nil {
+			return opts, fmt.Errorf("failed to extend scaffolder: %w", err)
+		}
+	}
+
+	for _, fn := range opts.contextualFuncs {
+		for k, v := range fn(&opts.Config) {
+			opts.Funcs[k] = v
+		}
+	}
+
+	opts.Funcs = opts.allowedFuncs(opts.Funcs)
+
+	for _, tmpl := range opts.excludeTemplates {
+		pattern, err := evaluateExclude(tmpl, opts.Context, opts.Funcs)
+		if err != nil {
+			return opts, &ExcludeError{Pattern: tmpl, Err: err}
+		}
+		if pattern != "" {
+			opts.Exclude = append(opts.Exclude, pattern)
+		}
+	}
+	return opts, nil
+}
+
+// allowedFuncs returns funcs restricted to those allowed by AllowFunctions,
+// recording the names of those removed.
+func (o *scaffoldOptions) allowedFuncs(funcs template.FuncMap) template.FuncMap {
+	if o.allowFunctions == nil {
+		return funcs
+	}
+	if o.disallowedFuncs == nil {
+		o.disallowedFuncs = map[string]bool{}
+	}
+	allowed := template.FuncMap{}
+	for name, fn := range funcs {
+		if o.allowFunctions[name] {
+			allowed[name] = fn
+		} else {
+			o.disallowedFuncs[name] = true
+		}
+	}
+	return allowed
+}
+
+// disallowedFuncRe matches the error from parsing a template that calls an
+// undefined function.
+var disallowedFuncRe = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// parseError wraps an error from parsing the template at path, explaining
+// when a function is undefined because it is not allowed.
+func (s *state) parseError(path string, err error) error {
+	if m := disallowedFuncRe.FindStringSubmatch(err.Error()); m != nil && s.disallowedFuncs[m[1]] {
+		err = fmt.Errorf("%w: function %q is not allowed", err, m[1])
+	}
+	return &TemplateError{Path: path, Line: templateErrorLine(path, err), Err: fmt.Errorf("failed to parse template: %w", err)}
+}
+
+// evaluateExclude evaluates an ExcludeTemplates pattern against ctx, and
+// checks that the result is a valid regex.
+func evaluateExclude(tmpl string, ctx any, funcs template.FuncMap) (_ string, err error) {
+	defer recoverPanic("exclude", &err)
+	t, err := template.New("exclude").Funcs(funcs).Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	out := &strings.Builder{}
+	if err := t.Execute(out, ctx); err != nil {
+		return "", err
+	}
+	pattern := strings.TrimSpace(out.String())
+	if _, err := regexp.Compile(pattern); err != nil {
+		return "", err
+	}
+	return pattern, nil
+}
+
+func newState(cancelCtx context.Context, src source, dst target, opts scaffoldOptions) *state {
+	if opts.metrics != nil {
+		*opts.metrics = Metrics{}
+	}
+	return &state{
+		cancelCtx:         cancelCtx,
+		root:              opts.source,
+		src:               src,
+		dst:               dst,
+		scaffoldOptions:   opts,
+		deferredSymlinks:  map[string]string{},
+		visiting:          map[string]bool{},
+		generated:         map[string]bool{},
+		collected:         map[string][]any{},
+		previousHashes:    map[string]string{},
+		keptHashes:        map[string]string{},
+		templateManifests: map[string]bool{},
+		dirs:              map[string]bool{},
+		pushedSymlinks:    map[string]bool{},
+	}
+}
+
+type state struct {
+	cancelCtx context.Context
+	// Root of the source tree currently being scaffolded. This is the source
+	// directory, or a subtree selected by pushFrom.
+	root string
+	src  source
+	dst  target
+	scaffoldOptions
+	deferredSymlinks map[string]string
+	// Whether writeManifest keeps the entries of the existing manifest for
+	// files not generated by this run, as for ScaffoldFile.
+	mergeManifest bool
+	// Resolved source directories currently being scaffolded, used to detect
+	// cycles when following symlinks.
+	visiting map[string]bool
+	// When planning, path names are evaluated and recorded in planned, keyed
+	// by destination directory, but nothing is written.
+	planning bool
+	planned  map[string][]string
+	// Values recorded by the collect function while planning.
+	collected map[string][]any
+	// When linting, per-entry errors are collected in errs rather than
+	// aborting.
+	lint bool
+	errs []error
+	// Whether .tmpl suffix removal is disabled by a noStripMarker in the
+	// directory being scaffolded or one of its parents.
+	noStrip bool
+	// Stack of files currently being evaluated by include.
+	includes []string
+	// Destination paths of the files and symlinks scaffolded so far.
+	generated map[string]bool
+	// Hashes of files recorded in the previous manifest, and of modified files
+	// to carry forward to the new manifest, keyed by destination path.
+	previousHashes map[string]string
+	keptHashes     map[string]string
+	// Source paths of the template manifests, which are not scaffolded.
+	templateManifests map[string]bool
+	// Destination directories created or ensured so far.
+	dirs map[string]bool
+	// Resolved roots of the templates being composed by the scaffold function,
+	// outermost first, used to detect cycles.
+	composing []string
+	// Destination paths of symlinks whose targets name directories generated
+	// by push or pushFrom, which must exist once scaffolding is complete.
+	pushedSymlinks map[string]bool
+}
+
+// scaffoldTemplates scaffolds each of the template roots in templates into
+// dstDir in turn, so that later templates override earlier ones.
+// entryFuncs returns the functions for the source entry at relPath, to be
+// scaffolded into dstDir.
+func (s *state) entryFuncs(relPath, dstDir string) template.FuncMap {
+	funcs := maps.Clone(s.Funcs)
+	funcs[includeFuncName] = s.includeFunc(relPath, funcs)
+	funcs[tplFuncName] = s.tplFunc(relPath, funcs)
+	funcs[scaffoldFuncName] = s.scaffoldFunc(dstDir)
+	if s.collect {
+		funcs["collect"] = func(key string, value any) string {
+			if s.planning {
+				s.collected[key] = append(s.collected[key], value)
+			}
+			return ""
+		}
+		funcs["collected"] = func(key string) []any { return s.collected[key] }
+	}
+	return funcs
+}
+
+func (s *state) scaffoldTemplates(templates []string, dstDir string, ctx any) error {
+	defer func(root string) { s.root = root }(s.root)
+	for _, root := range templates {
+		s.root = root
+		if err := s.scaffold(root, dstDir, ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *state) scaffold(srcDir, dstDir string, ctx any) error {
+	if s.followSymlinks {
+		realDir, err := s.src.RealPath(srcDir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve symlink: %w", err)
+		}
+		if s.visiting[realDir] {
+			return fmt.Errorf("%s: symlink cycle detected", srcDir)
+		}
+		s.visiting[realDir] = true
+		defer delete(s.visiting, realDir)
+	}
+	entries, err := s.src.ReadDir(srcDir)
+	if err != nil {
+		return &FSError{Op: "read directory", Path: srcDir, Err: err}
+	}
+	if !s.planning {
+		if err := s.ensureDir(dstDir); err != nil {
+			return err
+		}
+	}
+	defer func(noStrip bool) { s.noStrip = noStrip }(s.noStrip)
+	if slices.ContainsFunc(entries, isNoStripMarker) {
+		s.noStrip = true
+	}
+	for _, entry := range entries {
+		if err := s.cancelCtx.Err(); err != nil {
+			return err
+		}
+		if isNoStripMarker(entry) {
+			continue
+		}
+		srcPath := filepath.Join(srcDir, entry.Name())
+		if s.excludeDotfiles && strings.HasPrefix(entry.Name(), ".") {
+			s.skip(srcPath, "", SkipDotfile)
+			continue
+		}
+		if s.templateManifests[srcPath] {
+			continue
+		}
+		relPath, _ := filepath.Rel(s.root, srcPath) // Can't fail.
+		if s.maxDepth > 0 && strings.Count(filepath.ToSlash(relPath), "/") >= s.maxDepth {
+			s.skip(srcPath, "", SkipMaxDepth)
+			continue
+		}
+		if excluded, err := s.excluded(relPath); err != nil {
+			return err
+		} else if excluded {
+			s.skip(srcPath, "", SkipExcludedByPattern)
+			continue
+		}
+		if excluded, err := s.excludedIf(relPath, ctx); err != nil {
+			return err
+		} else if excluded {
+			s.skip(srcPath, "", SkipExcludedByFunc)
+			continue
+		}
+		funcs := s.entryFuncs(relPath, dstDir)
+
+		// Add a recursive function that can be used to recurse into subcontexts for files and directories.
+		// Pushed names are kept in call order so that output, and anything
+		// derived from it such as RecordTo and randPort, is stable.
+		recursiveNames := []string{}
+		recursiveContext := map[string]any{}
+		recursiveSource := map[string]string{}
+		push := func(name string, ctx any) {
+			if _, ok := recursiveContext[name]; !ok {
+				recursiveNames = append(recursiveNames, name)
+			}
+			recursiveContext[name] = ctx
+		}
+		funcs[recurseFuncName] = func(name string, ctx any) string {
+			push(name, ctx)
+			return name + "\000"
+		}
+		funcs[recurseFromFuncName] = func(name, subtree string, ctx any) string {
+			push(name, ctx)
+			recursiveSource[name] = subtree
+			return name + "\000"
+		}
+		dstName, err := s.evaluate(srcPath, entry.Name(), ctx, funcs)
+		if err != nil {
+			if err := s.check(fmt.Errorf("failed to evaluate path name %q: %w", filepath.Join(dstDir, entry.Name()), err)); err != nil {
+				return err
+			}
+			continue
+		}
+		if dstName == "" {
+			// Entry is excluded. For directories this prunes the whole subtree
+			// without reading it.
+			s.skip(srcPath, "", SkipEmptyName)
+			continue
+		}
+
+		if !s.noStrip {
+			dstName = strings.TrimSuffix(dstName, ".tmpl")
+		}
+		if s.platform != nil {
+			var ok bool
+			if dstName, ok = s.platformName(dstName); !ok || dstName == "" {
+				s.skip(srcPath, "", SkipPlatform)
+				continue
+			}
+		}
+		dstPath := filepath.Join(dstDir, dstName)
+
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to get file info: %w", err)
+		}
+		if s.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+			info, err = s.src.Stat(srcPath)
+			if err != nil {
+				return fmt.Errorf("failed to follow symlink: %w", err)
+			}
+		}
+
+		if len(recursiveContext) == 0 {
+			if err := s.check(s.scaffoldEntry(info, srcPath, dstPath, ctx, funcs)); err != nil {
+				return err
+			}
+		}
+		for _, subEntry := range recursiveNames {
+			subCtx := recursiveContext[subEntry]
+			if subtree, ok := recursiveSource[subEntry]; ok {
+				if err := s.check(s.scaffoldSubtree(subtree, filepath.Join(dstDir, subEntry), subCtx)); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := s.check(s.scaffoldEntry(info, srcPath, filepath.Join(dstDir, subEntry), subCtx, funcs)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// includeFunc returns the "include" function for templates in the file at
+// relPath.
+//
+// include evaluates the file at the given path, relative to the source root,
+// as a template with the given context.
+func (s *state) includeFunc(relPath string, funcs template.FuncMap) func(name string, ctx any) (string, error) {
+	return func(name string, ctx any) (string, error) {
+		if !filepath.IsLocal(name) {
+			return "", fmt.Errorf("%q is outside the source directory", name)
+		}
+		if len(s.includes) >= s.maxIncludeDepth {
+			chain := strings.Join(append(append([]string{relPath}, s.includes...), name), " -> ")
+			if slices.Contains(s.includes, name) {
+				return "", fmt.Errorf("include cycle detected: %s", chain)
+			}
+			return "", fmt.Errorf("maximum include depth of %d exceeded: %s", s.maxIncludeDepth, chain)
+		}
+		s.includes = append(s.includes, name)
+		defer func() { s.includes = s.includes[:len(s.includes)-1] }()
+		path := filepath.Join(s.source, name)
+		tmpl, err := s.src.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return s.evaluate(path, string(tmpl), ctx, funcs)
+	}
+}
+
+// tplFunc returns the "tpl" function for templates in the file at relPath.
+//
+// tpl evaluates the given text as a template with the given context. Nested
+// evaluation counts towards the include depth.
+func (s *state) tplFunc(relPath string, funcs template.FuncMap) func(text string, ctx any) (string, error) {
+	return func(text string, ctx any) (string, error) {
+		if len(s.includes) >= s.maxIncludeDepth {
+			chain := strings.Join(append(append([]string{relPath}, s.includes...), tplFuncName), " -> ")
+			return "", fmt.Errorf("maximum include depth of %d exceeded: %s", s.maxIncludeDepth, chain)
+		}
+		s.includes = append(s.includes, tplFuncName)
+		defer func() { s.includes = s.includes[:len(s.includes)-1] }()
+		return s.evaluate(relPath, text, ctx, funcs)
+	}
+}
+
+// scaffoldFunc returns the "scaffold" function for entries in dstDir.
+//
+// scaffold scaffolds the template tree at the given path, relative to the root
+// of the calling template, into dstDir with the given context, and evaluates to
+// the empty string.
+func (s *state) scaffoldFunc(dstDir string) func(name string, ctx any) (string, error) {
+	return func(name string, ctx any) (string, error) {
+		root := s.root
+		if len(s.composing) == 0 {
+			realRoot, err := s.src.RealPath(root)
+			if err != nil {
+				return "", &FSError{Op: "resolve template", Path: root, Err: err}
+			}
+			s.composing = []string{realRoot}
+			defer func() { s.composing = nil }()
+		}
+		srcDir := name
+		if !filepath.IsAbs(srcDir) {
+			srcDir = filepath.Join(root, name)
+		}
+		realDir, err := s.src.RealPath(srcDir)
+		if err != nil {
+			return "", &FSError{Op: "resolve template", Path: srcDir, Err: err}
+		}
+		if slices.Contains(s.composing, realDir) {
+			return "", fmt.Errorf("%s: cycle detected: %s", scaffoldFuncName, strings.Join(append(slices.Clone(s.composing), realDir), " -> "))
+		}
+		info, err := s.src.Stat(realDir)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", scaffoldFuncName, err)
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s: %q is not a directory", scaffoldFuncName, name)
+		}
+		s.composing = append(s.composing, realDir)
+		defer func() { s.composing = s.composing[:len(s.composing)-1] }()
+		if err := s.scaffoldTemplates([]string{realDir}, dstDir, ctx); err != nil {
+			return "", fmt.Errorf("%s %q: %w", scaffoldFuncName, name, err)
+		}
+		return "", nil
+	}
+}
+
+// afterAll calls the AfterAll hook of each plugin implementing
+// AfterAllExtension.
+func (s *state) afterAll() error {
+	for _, plugin := range s.plugins {
+		if plugin, ok := plugin.(AfterAllExtension); ok {
+			if err := plugin.AfterAll(&s.Config); err != nil {
+				return fmt.Errorf("failed to run after all: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeExtraFiles writes the files registered with Config.AddFile.
+func (s *state) writeExtraFiles() error {
+	// Extra files may register further extra files from AfterEach.
+	for i := 0; i < len(*s.extra); i++ {
+		file := (*s.extra)[i]
+		if excluded, err := s.excluded(file.path); err != nil {
+			return err
+		} else if excluded {
+			continue
+		}
+		dstPath := filepath.Join(s.target, file.path)
+		if _, ok := s.deferredSymlinks[dstPath]; ok || s.generated[dstPath] {
+			return fmt.Errorf("extra file %q conflicts with a scaffolded file", file.path)
+		}
+		s.generated[dstPath] = true
+		if err := s.ensureDir(filepath.Dir(dstPath)); err != nil {
+			return err
+		}
+		start := time.Now()
+		if err := s.dst.WriteFile(dstPath, file.content, file.mode); err != nil {
+			return &FSError{Op: "write extra file", Path: dstPath, Err: err}
+		}
+		s.metrics.addWrite(start, EntryFile)
+		if err := s.afterEach(dstPath, EntryFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeGitkeeps writes the Gitkeep placeholder into each generated directory
+// that is empty.
+func (s *state) writeGitkeeps() error {
+	if s.gitkeep == "" {
+		return nil
+	}
+	dirs := make([]string, 0, len(s.dirs))
+	for dir := range s.dirs {
+		if dir != s.target {
+			dirs = append(dirs, dir)
+		}
+	}
+	slices.Sort(dirs)
+	for _, dir := range dirs {
+		entries, err := s.dst.ReadDir(dir)
+		if err != nil {
+			return &FSError{Op: "read directory", Path: dir, Err: err}
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		dstPath := filepath.Join(dir, s.gitkeep)
+		s.generated[dstPath] = true
+		start := time.Now()
+		if err := s.dst.WriteFile(dstPath, nil, 0600); err != nil {
+			return &FSError{Op: "write gitkeep file", Path: dstPath, Err: err}
+		}
+		s.metrics.addWrite(start, EntryFile)
+		if err := s.afterEach(dstPath, EntryFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check returns err, unless linting in which case err is recorded and
+// scaffolding continues.
+func (s *state) check(err error) error {
+	if err == nil || !s.lint {
+		return err
+	}
+	s.errs = append(s.errs, err)
+	return nil
+}
+
+// scaffoldSubtree scaffolds the directory subtree, relative to the source
+// root, into dstPath.
+//
+// Exclude patterns are matched relative to subtree.
+func (s *state) scaffoldSubtree(subtree, dstPath string, ctx any) error {
+	if !filepath.IsLocal(subtree) {
+		return fmt.Errorf("%s: subtree %q is outside the source directory", recurseFromFuncName, subtree)
+	}
+	srcPath := filepath.Join(s.source, subtree)
+	info, err := s.src.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("%s: %w", recurseFromFuncName, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s: subtree %q is not a directory", recurseFromFuncName, subtree)
+	}
+	root := s.root
+	s.root = srcPath
+	defer func() { s.root = root }()
+	return s.scaffoldEntry(info, srcPath, dstPath, ctx, s.Funcs)
+}
+
+func (s *state) scaffoldEntry(info fs.FileInfo, srcPath, dstPath string, ctx any, funcs template.FuncMap) error {
+	if info.Mode().IsRegular() {
+		if _, suffix := s.renderer(srcPath); suffix != "" {
+			dstPath = strings.TrimSuffix(dstPath, suffix)
+		}
+	}
+	if s.planning {
+		dir := filepath.Dir(dstPath)
+		s.planned[dir] = append(s.planned[dir], filepath.Base(dstPath))
+		if info.Mode().IsDir() {
+			return s.scaffold(srcPath, dstPath, ctx)
+		}
+		return nil
+	}
+	if s.siblings {
+		funcs["siblings"] = func() []string {
+			siblings := slices.DeleteFunc(slices.Clone(s.planned[filepath.Dir(dstPath)]), func(name string) bool {
+				return name == filepath.Base(dstPath)
+			})
+			slices.Sort(siblings)
+			return slices.Compact(siblings)
+		}
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := s.src.Readlink(srcPath)
+		if err != nil {
+			return &FSError{Op: "read symlink", Path: srcPath, Err: err}
+		}
+
+		// In a target, push and pushFrom name the directory they generate,
+		// rather than fanning out the symlink itself.
+		funcs = maps.Clone(funcs)
+		pushed := false
+		funcs[recurseFuncName] = func(name string, ctx any) string {
+			pushed = true
+			return name
+		}
+		funcs[recurseFromFuncName] = func(name, subtree string, ctx any) string {
+			pushed = true
+			return name
+		}
+		target, err = s.evaluate(srcPath, target, ctx, funcs)
+		if err != nil {
+			return fmt.Errorf("failed to evaluate symlink target: %w", err)
+		}
+		if pushed {
+			s.pushedSymlinks[dstPath] = true
+		}
+
+		// Ensure symlink is relative.
+		if filepath.IsAbs(target) {
+			absDstPath, err := filepath.Abs(dstPath)
+			if err != nil {
+				return fmt.Errorf("failed to make symlink relative: %w", err)
+			}
+			rel, err := filepath.Rel(filepath.Dir(absDstPath), filepath.Clean(target))
+			if err != nil {
+				return fmt.Errorf("failed to make symlink relative: %w", err)
+			}
+			target = rel
+		}
+
+		s.deferredSymlinks[dstPath] = target
+
+	case info.Mode().IsDir():
+		start := time.Now()
+		if err := s.ensureDir(dstPath); err != nil {
+			return err
+		}
+		s.metrics.addWrite(start, EntryDir)
+		if err := s.afterEach(dstPath, EntryDir); err != nil {
+			return err
+		}
+		return s.scaffold(srcPath, dstPath, ctx)
+
+	case info.Mode().IsRegular():
+		template, err := s.src.ReadFile(srcPath)
+		if err != nil {
+			return &FSError{Op: "read file", Path: srcPath, Err: err}
+		}
+		var chmod *os.FileMode
+		funcs[chmodFuncName] = func(mode int) string {
+			m := os.FileMode(mode) & os.ModePerm
+			chmod = &m
+			return ""
+		}
+		relPath, _ := filepath.Rel(s.root, srcPath) // Can't fail.
+		binary := s.isBinary(relPath, template[:min(len(template), binaryHeadSize)])
+		content := string(template)
+		if binary {
+			s.skip(srcPath, dstPath, SkipBinaryCopied)
+		} else if content, err = s.renderFile(srcPath, dstPath, content, ctx, funcs); err != nil {
+			return err
+		}
+		if s.protectedRegions && !binary {
+			if existing, err := s.dst.ReadFile(dstPath); err == nil {
+				if content, err = preserveRegions(string(existing), content); err != nil {
+					return fmt.Errorf("%s: failed to preserve protected regions: %w", dstPath, err)
+				}
+			}
+		}
+		s.generated[dstPath] = true
+		if s.skipUnchanged {
+			if existing, err := s.dst.ReadFile(dstPath); err == nil && string(existing) == content {
+				s.skip(srcPath, dstPath, SkipUnchangedContent)
+				return nil
+			}
+		}
+		if s.overwriteUnmodified && s.modified(dstPath) {
+			s.skip(srcPath, dstPath, SkipConflict)
+			return nil
+		}
+		if s.overwriteOnly != nil && !s.overwritable(dstPath) {
+			if _, err := s.dst.Lstat(dstPath); err == nil {
+				s.skip(srcPath, dstPath, SkipConflict)
+				return nil
+			}
+		}
+		mode := info.Mode()
+		if s.executableShebang && strings.HasPrefix(content, "#!") {
+			// Grant execute permission wherever read permission is granted.
+			mode |= (mode & 0o444) >> 2
+		}
+		if chmod != nil {
+			mode = *chmod
+		}
+		start := time.Now()
+		err = s.dst.WriteFile(dstPath, []byte(content), mode)
+		if err != nil {
+			return &FSError{Op: "write file", Path: dstPath, Err: err}
+		}
+		if chmod != nil || s.forceMode {
+			// Apply the mode exactly, regardless of umask or an existing file.
+			if err := s.dst.Chmod(dstPath, mode); err != nil {
+				return &FSError{Op: "set file mode", Path: dstPath, Err: err}
+			}
+		}
+		s.metrics.addWrite(start, EntryFile)
+		if s.preserveTimes {
+			mtime := info.ModTime()
+			if mtime.IsZero() {
+				mtime = time.Unix(0, 0)
+			}
+			if err := s.dst.Chtimes(dstPath, mtime, mtime); err != nil {
+				return &FSError{Op: "set file times", Path: dstPath, Err: err}
+			}
+		}
+		if err := s.afterEach(dstPath, EntryFile); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("%s: unsupported file type %s", srcPath, info.Mode())
+	}
+	return nil
+}
+
+// renderFile evaluates body, the content of the regular file at srcPath, and
+// applies content filters.
+func (s *state) renderFile(srcPath, dstPath, body string, ctx any, funcs template.FuncMap) (string, error) {
+	if s.frontMatter {
+		values, rest, err := splitFrontMatter(body)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", srcPath, err)
+		}
+		if values != nil {
+			if ctx, err = mergeContext(ctx, values); err != nil {
+				return "", fmt.Errorf("%s: %w", srcPath, err)
+			}
+			body = rest
+		}
+	}
+	content, err := s.evaluateContent(srcPath, dstPath, body, ctx, funcs)
+	if err != nil {
+		return "", fmt.Errorf("%s: failed to evaluate template: %w", srcPath, err)
+	}
+	for _, filter := range s.contentFilters {
+		if content, err = filter(dstPath, content); err != nil {
+			return "", fmt.Errorf("%s: failed to filter content: %w", srcPath, err)
+		}
+	}
+	return content, nil
+}
+
+func isNoStripMarker(entry fs.DirEntry) bool {
+	return entry.Name() == noStripMarker && entry.Type().IsRegular()
+}
+
+// platformName removes platform suffixes from name, reporting whether they
+// match the selected platform.
+func (s *state) platformName(name string) (string, bool) {
+	match := true
+	for {
+		ext := filepath.Ext(name)
+		if goos, ok := strings.CutPrefix(ext, ".goos-"); ok {
+			match = match && goos == s.platform[0]
+		} else if goarch, ok := strings.CutPrefix(ext, ".goarch-"); ok {
+			match = match && goarch == s.platform[1]
+		} else {
+			return name, match
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+}
+
+// applyModes applies ApplyModes to the generated regular files.
+func (s *state) applyModes() error {
+	if len(s.modes) == 0 {
+		return nil
+	}
+	// Patterns of equal length are considered in lexical order, so the first
+	// wins a tie regardless of map iteration order.
+	patterns := make([]string, 0, len(s.modes))
+	for pattern := range s.modes {
+		patterns = append(patterns, pattern)
+	}
+	slices.Sort(patterns)
+	for dstPath := range s.generated {
+		rel, err := filepath.Rel(s.target, dstPath)
+		if err != nil {
+			continue
+		}
+		pattern := ""
+		for _, candidate := range patterns {
+			if len(candidate) > len(pattern) && matchPath(candidate, rel) {
+				pattern = candidate
+			}
+		}
+		if pattern == "" {
+			continue
+		}
+		if info, err := s.dst.Lstat(dstPath); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if err := s.dst.Chmod(dstPath, s.modes[pattern]&os.ModePerm); err != nil {
+			return &FSError{Op: "set file mode", Path: dstPath, Err: err}
+		}
+	}
+	return nil
+}
+
+// applyFixedTime applies FixedTime to the generated files, the manifest, and
+// the directories containing them.
+func (s *state) applyFixedTime() error {
+	if s.fixedTime == nil {
+		return nil
+	}
+	paths := map[string]bool{}
+	for path := range s.generated {
+		paths[path] = true
+	}
+	if s.manifestPath != "" {
+		paths[filepath.Join(s.target, s.manifestPath)] = true
+	}
+	for path := range paths {
+		for dir := filepath.Dir(path); dir != s.target && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+			paths[dir] = true
+		}
+	}
+	for path := range paths {
+		if info, err := s.dst.Lstat(path); err != nil || info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		if err := s.dst.Chtimes(path, *s.fixedTime, *s.fixedTime); err != nil {
+			return &FSError{Op: "set file times", Path: path, Err: err}
+		}
+	}
+	return nil
+}
+
+// complete calls the OnComplete hooks with the generated paths.
+func (s *state) complete() error {
+	if len(s.onComplete) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(s.generated))
+	for dstPath := range s.generated {
+		rel, err := filepath.Rel(s.target, dstPath)
+		if err != nil {
+			continue
+		}
+		files = append(files, rel)
+	}
+	slices.Sort(files)
+	for _, complete := range s.onComplete {
+		if err := complete(slices.Clone(files)); err != nil {
+			return fmt.Errorf("failed to run on complete: %w", err)
+		}
+	}
+	return nil
+}
+
+// overwritable reports whether an existing file at dstPath may be replaced
+// under OverwriteOnly.
+func (s *state) overwritable(dstPath string) bool {
+	rel, err := filepath.Rel(s.target, dstPath)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range s.overwriteOnly {
+		if matchPath(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether the relative OS path rel matches the glob
+// pattern, as understood by path.Match. A pattern without a "/" is matched
+// against the file name alone.
+func matchPath(pattern, rel string) bool {
+	name := filepath.ToSlash(rel)
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(name)
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+// ensureDir creates the directory at path if it does not exist.
+//
+// If path already exists it must be a directory or a symlink to a directory.
+func (s *state) ensureDir(path string) error {
+	err := s.dst.MkdirAll(path, 0700)
+	if err == nil {
+		s.dirs[path] = true
+		return nil
+	}
+	if info, serr := s.dst.Stat(path); serr == nil && !info.IsDir() {
+		return &FSError{Op: "create directory", Path: path, Err: fmt.Errorf("%s exists and is not a directory", path)}
+	}
+	return &FSError{Op: "create directory", Path: path, Err: err}
+}
+
+// Recursively apply symlinks.
+func (s *state) applySymlinks(path string) error {
+	target, ok := s.deferredSymlinks[path]
+	if !ok {
+		return nil
+	}
+	targetPath := filepath.Clean(filepath.Join(filepath.Dir(path), target))
+	if err := s.applySymlinks(targetPath); err != nil {
+		return fmt.Errorf("failed to apply symlink: %w", err)
+	}
+	delete(s.deferredSymlinks, path)
+	err := s.dst.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return &FSError{Op: "remove symlink target", Path: path, Err: err}
+	}
+	start := time.Now()
+	if err := s.dst.Symlink(target, path); err != nil {
+		return &FSError{Op: "create symlink", Path: path, Err: err}
+	}
+	s.metrics.addWrite(start, EntrySymlink)
+	s.generated[path] = true
+	if s.pushedSymlinks[path] {
+		if _, err := s.dst.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s: symlink target %q does not exist after scaffolding", path, target)
+		}
+	}
+	if err := s.recordEntry(path, EntrySymlink, target); err != nil {
+		return err
+	}
+	return s.afterEach(path, EntrySymlink)
+}
+
+// afterEach calls the AfterEach hook of each plugin for the entry at path.
+func (s *state) afterEach(path string, kind EntryKind) error {
+	if kind != EntrySymlink {
+		if err := s.recordEntry(path, kind, ""); err != nil {
+			return err
+		}
+	}
+	if s.owner != nil && runtime.GOOS != "windows" {
+		if err := s.dst.Lchown(path, s.owner[0], s.owner[1]); err != nil {
+			if errors.Is(err, fs.ErrPermission) {
+				err = fmt.Errorf("insufficient privileges to change owner to %d:%d: %w", s.owner[0], s.owner[1], err)
+			}
+			return &FSError{Op: "set owner", Path: path, Err: err}
+		}
+	}
+	var info fs.FileInfo
+	for _, plugin := range s.plugins {
+		if plugin, ok := plugin.(EntryExtension); ok {
+			if info == nil {
+				stat := s.dst.Stat
+				if kind == EntrySymlink {
+					stat = s.dst.Lstat
+				}
+				var err error
+				if info, err = stat(path); err != nil {
+					return fmt.Errorf("failed to get file info: %w", err)
+				}
+			}
+			if err := plugin.AfterEachEntry(path, info, kind); err != nil {
+				return fmt.Errorf("failed to run after: %w", err)
+			}
+			continue
+		}
+		if kind == EntrySymlink {
+			continue
+		}
+		if err := plugin.AfterEach(path); err != nil {
+			return fmt.Errorf("failed to run after: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *state) evaluate(path, tmpl string, ctx any, funcs template.FuncMap) (string, error) {
+	out := &strings.Builder{}
+	if err := s.execute(out, s.engine, path, tmpl, ctx, funcs); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// evaluateContent evaluates the content of the regular file at srcPath.
+func (s *state) evaluateContent(srcPath, dstPath, tmpl string, ctx any, funcs template.FuncMap) (_ string, err error) {
+	// Renderers and render wrappers are arbitrary code, so recover from them too.
+	defer recoverPanic(srcPath, &err)
+	render := func(path, tmpl string, ctx any) (string, error) {
+		out := &strings.Builder{}
+		var w io.Writer = out
+		if s.maxFileSize > 0 {
+			w = &limitWriter{w: out, remaining: s.maxFileSize}
+		}
+		var err error
+		if render, _ := s.renderer(path); render != nil {
+			var content string
+			start := time.Now()
+			content, err = render(path, tmpl, ctx)
+			s.metrics.addExecute(start)
+			if err == nil {
+				_, err = io.WriteString(w, content)
+			}
+		} else if _, ok := s.engine.(textEngine); ok && s.htmlEscape && isHTML(dstPath) {
+			err = s.execute(w, htmlEngine{}, path, tmpl, ctx, funcs)
+		} else {
+			err = s.execute(w, s.engine, path, tmpl, ctx, funcs)
+		}
+		if err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+	for i := len(s.plugins) - 1; i >= 0; i-- {
+		if plugin, ok := s.plugins[i].(RenderExtension); ok {
+			render = plugin.WrapRender(render)
+		}
+	}
+	return render(srcPath, tmpl, ctx)
+}
+
+// recoverPanic converts a panic while rendering path, such as from a
+// misbehaving template function, into an error assigned to err.
+func recoverPanic(path string, err *error) {
+	if r := recover(); r != nil {
+		*err = &TemplateError{Path: path, Err: fmt.Errorf("panic while rendering: %v", r)}
+	}
+}
+
+// execute evaluates tmpl from path with engine, writing the result to w.
+func (s *state) execute(w io.Writer, engine Engine, path, tmpl string, ctx any, funcs template.FuncMap) (err error) {
+	defer recoverPanic(path, &err)
+	start := time.Now()
+	t, err := engine.Parse(path, tmpl, FuncMap(s.allowedFuncs(funcs)))
+	s.metrics.addParse(start)
+	if err != nil {
+		return s.parseError(path, err)
+	}
+	start = time.Now()
+	err = engine.Execute(w, t, ctx)
+	s.metrics.addExecute(start)
+	if err != nil {
+		return &TemplateError{Path: path, Line: templateErrorLine(path, err), Err: s.secrets.redact(fmt.Errorf("failed to execute template: %w", err))}
+	}
+	return nil
+}
+
+// limitWriter fails with ErrFileTooLarge once more than remaining bytes have
+// been written.
+type limitWriter struct {
+	w         io.Writer
+	remaining int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining {
+		return 0, ErrFileTooLarge
+	}
+	l.remaining -= int64(len(p))
+	return l.w.Write(p)
+}
+
+func isHTML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return true
 	}
-	return newName.String(), nil
+	return false
 }
@@ -1,9 +1,21 @@
 package scaffolder_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 
@@ -32,3 +44,1838 @@ func TestScaffolder(t *testing.T) {
 	}
 	scaffoldertest.AssertFilesEqual(t, tmpDir, expect)
 }
+
+func TestHTMLEscape(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"index.html.tmpl": "<p>{{ .Value }}</p>",
+		"notes.txt":       "{{ .Value }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Value": "a < b"}, scaffolder.HTMLEscape())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "index.html", Mode: 0o600, Content: "<p>a &lt; b</p>"},
+		{Name: "notes.txt", Mode: 0o600, Content: "a < b"},
+	})
+}
+
+func TestContextualFunctions(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"source.txt": "{{ sourceName }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.ContextualFunctions(func(cfg *scaffolder.Config) scaffolder.FuncMap {
+		return scaffolder.FuncMap{
+			"sourceName": func() string { return filepath.Base(cfg.Source()) },
+		}
+	}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "source.txt", Mode: 0o600, Content: filepath.Base(src)},
+	})
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"unchanged.txt": "{{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"}, scaffolder.SkipUnchanged())
+	assert.NoError(t, err)
+	path := filepath.Join(dest, "unchanged.txt")
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.NoError(t, os.Chtimes(path, mtime, mtime))
+
+	err = scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"}, scaffolder.SkipUnchanged())
+	assert.NoError(t, err)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, mtime, info.ModTime())
+}
+
+func TestOverwriteOnly(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"pkg/model.go":     "package {{ .Version }}",
+		"pkg/model_gen.go": "package {{ .Version }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Version": "v1"}, scaffolder.OverwriteOnly("*_gen.go"))
+	assert.NoError(t, err)
+
+	err = scaffolder.Scaffold(src, dest, map[string]any{"Version": "v2"}, scaffolder.OverwriteOnly("*_gen.go"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "pkg/model.go", Mode: 0o600, Content: "package v1"},
+		{Name: "pkg/model_gen.go", Mode: 0o600, Content: "package v2"},
+	})
+}
+
+func TestProtectedRegions(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go": `// Version {{ .Version }}
+func init() {
+	// scaffolder:keep init
+	// Add initialisation here.
+	// scaffolder:end
+}
+`,
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Version": "1"}, scaffolder.ProtectedRegions())
+	assert.NoError(t, err)
+
+	path := filepath.Join(dest, "main.go")
+	edited, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, []byte(strings.ReplaceAll(string(edited), "// Add initialisation here.", "setup()")), 0o600))
+
+	err = scaffolder.Scaffold(src, dest, map[string]any{"Version": "2"}, scaffolder.ProtectedRegions())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "main.go", Mode: 0o600, Content: `// Version 2
+func init() {
+	// scaffolder:keep init
+	setup()
+	// scaffolder:end
+}
+`},
+	})
+}
+
+func TestProtectedRegionsUnnamedComments(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"index.html": `<h1>{{ .Title }}</h1>
+<!-- scaffolder:keep -->
+<p>First</p>
+<!-- scaffolder:end -->
+<!-- scaffolder:keep -->
+<p>Second</p>
+<!-- scaffolder:end -->
+`,
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Title": "Old"}, scaffolder.ProtectedRegions())
+	assert.NoError(t, err)
+
+	path := filepath.Join(dest, "index.html")
+	edited, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	content := strings.NewReplacer("First", "One", "Second", "Two").Replace(string(edited))
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	err = scaffolder.Scaffold(src, dest, map[string]any{"Title": "New"}, scaffolder.ProtectedRegions())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "index.html", Mode: 0o600, Content: `<h1>New</h1>
+<!-- scaffolder:keep -->
+<p>One</p>
+<!-- scaffolder:end -->
+<!-- scaffolder:keep -->
+<p>Two</p>
+<!-- scaffolder:end -->
+`},
+	})
+}
+
+func TestProtectedRegionsDuplicateName(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.c": "/* scaffolder:keep body */\n/* scaffolder:end */\n/* scaffolder:keep body */\n/* scaffolder:end */\n",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.ProtectedRegions())
+	assert.NoError(t, err)
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.ProtectedRegions())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `duplicate "scaffolder:keep" region "body"`)
+}
+
+func TestExcludeIf(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go":            "package main",
+		"tests/main_test.go": "package main",
+	})
+	excludeTests := scaffolder.ExcludeIf(func(rel string, ctx any) (bool, error) {
+		return rel == "tests" && !ctx.(map[string]any)["IncludeTests"].(bool), nil
+	})
+
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"IncludeTests": false}, excludeTests)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "main.go", Mode: 0o600, Content: "package main"},
+	})
+
+	dest = t.TempDir()
+	err = scaffolder.Scaffold(src, dest, map[string]any{"IncludeTests": true}, excludeTests)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "main.go", Mode: 0o600, Content: "package main"},
+		{Name: "tests/main_test.go", Mode: 0o600, Content: "package main"},
+	})
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.ExcludeIf(func(rel string, ctx any) (bool, error) {
+		return false, errors.New("boom")
+	}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "boom")
+}
+
+func TestPlatform(t *testing.T) {
+	for _, test := range []struct {
+		os       string
+		expected []scaffoldertest.File
+	}{
+		{"linux", []scaffoldertest.File{
+			{Name: "Makefile", Mode: 0o600, Content: "linux"},
+			{Name: "README.md", Mode: 0o600, Content: "readme"},
+			{Name: "bin/run", Mode: 0o600, Content: "amd64"},
+		}},
+		{"windows", []scaffoldertest.File{
+			{Name: "Makefile", Mode: 0o600, Content: "windows"},
+			{Name: "README.md", Mode: 0o600, Content: "readme"},
+		}},
+	} {
+		dest := t.TempDir()
+		ctx := map[string]any{"OS": test.os}
+		err := scaffolder.Scaffold("testdata/platform", dest, ctx, scaffolder.Platform(test.os, "amd64"))
+		assert.NoError(t, err)
+		scaffoldertest.AssertFilesEqual(t, dest, test.expected)
+	}
+}
+
+func TestOnComplete(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md": "readme",
+		"{{ range .Services }}{{ push . . }}{{ end }}/main.go": "package {{ . }}",
+	})
+	assert.NoError(t, os.Symlink("README.md", filepath.Join(src, "link")))
+	calls := 0
+	var files []string
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Services": []string{"api", "worker"}},
+		scaffolder.Extend(scaffolder.ExtensionFunc(func(cfg *scaffolder.Config) error {
+			return cfg.AddFile("index.txt", []byte("index"), 0o600)
+		})),
+		scaffolder.OnComplete(func(generated []string) error {
+			calls++
+			files = generated
+			return nil
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"README.md", filepath.Join("api", "main.go"), "index.txt", "link", filepath.Join("worker", "main.go")}, files)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Services": []string{}},
+		scaffolder.OnComplete(func([]string) error { return errors.New("formatter failed") }))
+	assert.EqualError(t, err, "failed to run on complete: formatter failed")
+}
+
+func TestTemplateManifestExtends(t *testing.T) {
+	root := "testdata/inherit"
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(filepath.Join(root, "app"), dest, map[string]any{"Name": "api"}, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "LICENSE", Mode: 0o600, Content: "license"},
+		{Name: "README.md", Mode: 0o600, Content: "api readme"},
+		{Name: "ci/build.yaml", Mode: 0o600, Content: "app build"},
+		{Name: "cmd/api.go", Mode: 0o600, Content: "package main"},
+		{Name: "main.go", Mode: 0o600, Content: "package api"},
+	})
+
+	err = scaffolder.Scaffold("testdata/inherit-cycle/app", t.TempDir(), nil, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "template inheritance cycle detected")
+}
+
+func TestCollectMetrics(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md": "{{ .Name }}",
+		"{{ range .Services }}{{ push . . }}{{ end }}/main.go": "package {{ . }}",
+	})
+	assert.NoError(t, os.Symlink("README.md", filepath.Join(src, "link")))
+	var metrics scaffolder.Metrics
+	var files []string
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "app", "Services": []string{"api", "worker"}},
+		scaffolder.CollectMetrics(&metrics),
+		scaffolder.OnComplete(func(generated []string) error {
+			files = generated
+			return nil
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, metrics.Files)
+	assert.Equal(t, 2, metrics.Directories)
+	assert.Equal(t, 1, metrics.Symlinks)
+	assert.Equal(t, len(files), metrics.Files+metrics.Symlinks)
+	// The names of the three root entries and of main.go in each pushed
+	// directory, the symlink target, and the content of the three files.
+	assert.Equal(t, 9, metrics.Templates)
+	assert.True(t, metrics.ParseTime > 0)
+	assert.True(t, metrics.ExecuteTime > 0)
+	assert.True(t, metrics.WriteTime > 0)
+}
+
+func TestExcludeTemplates(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"mobile/app.swift": "swift",
+		"web/index.html":   "html",
+		"a+b.txt":          "literal",
+		"aab.txt":          "regex",
+	})
+	for _, test := range []struct {
+		mobile   bool
+		expected []scaffoldertest.File
+	}{
+		{false, []scaffoldertest.File{
+			{Name: "aab.txt", Mode: 0o600, Content: "regex"},
+			{Name: "web/index.html", Mode: 0o600, Content: "html"},
+		}},
+		{true, []scaffoldertest.File{
+			{Name: "aab.txt", Mode: 0o600, Content: "regex"},
+			{Name: "mobile/app.swift", Mode: 0o600, Content: "swift"},
+			{Name: "web/index.html", Mode: 0o600, Content: "html"},
+		}},
+	} {
+		dest := t.TempDir()
+		ctx := map[string]any{"Mobile": test.mobile, "Literal": "a+b.txt"}
+		err := scaffolder.Scaffold(src, dest, ctx, scaffolder.ExcludeTemplates(
+			`{{ if not .Mobile }}^mobile{{ end }}`,
+			`^{{ regexQuote .Literal }}$`,
+		))
+		assert.NoError(t, err)
+		scaffoldertest.AssertFilesEqual(t, dest, test.expected)
+	}
+
+	err := scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Name": "("}, scaffolder.ExcludeTemplates(`^{{ .Name }}`))
+	var excludeErr *scaffolder.ExcludeError
+	assert.True(t, errors.As(err, &excludeErr))
+}
+
+func TestOnPlan(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md": "readme",
+		"{{ range .Services }}{{ push . . }}{{ end }}/main.go": "package {{ . }}",
+		"{{ if .Docs }}docs{{ end }}/index.md":                 "docs",
+	})
+	assert.NoError(t, os.Symlink("README.md", filepath.Join(src, "link")))
+	total := -1
+	entries := 0
+	err := scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Services": []string{"api", "worker"}},
+		scaffolder.OnPlan(func(n int) {
+			assert.Equal(t, 0, entries, "plan should be called before any entries are written")
+			total = n
+		}),
+		scaffolder.AfterEachEntry(func(string, fs.FileInfo, scaffolder.EntryKind) error {
+			entries++
+			return nil
+		}))
+	assert.NoError(t, err)
+	// README.md, link, and api and worker with a main.go in each.
+	assert.Equal(t, 6, total)
+	assert.Equal(t, total, entries)
+}
+
+func TestNoStripMarker(t *testing.T) {
+	dest := t.TempDir()
+	err := scaffolder.Scaffold("testdata/no-strip", dest, map[string]any{"Name": "app"})
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "main.go", Mode: 0o600, Content: "package app"},
+		{Name: "other/config.yaml", Mode: 0o600, Content: "config"},
+		{Name: "templates/nested/handler.go.tmpl", Mode: 0o600, Content: "handler"},
+		{Name: "templates/service.go.tmpl", Mode: 0o600, Content: "app {{ .Service }}"},
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"out":        "{{ if isDryRun }}preview{{ else }}expensive{{ end }}",
+		"dir/nested": "nested",
+	})
+	dest := t.TempDir()
+	var written []string
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.DryRun(), scaffolder.AfterEach(func(path string) error {
+		written = append(written, path)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dest, "dir"), filepath.Join(dest, "dir", "nested"), filepath.Join(dest, "out")}, written)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{})
+
+	assert.Equal(t, "expensive", render(t, "{{ if isDryRun }}preview{{ else }}expensive{{ end }}", nil))
+	out, err := scaffolder.Render(fstest.MapFS{"out": {Data: []byte("{{ isDryRun }}")}}, nil, scaffolder.DryRun())
+	assert.NoError(t, err)
+	content, err := fs.ReadFile(out, "out")
+	assert.NoError(t, err)
+	assert.Equal(t, "true", string(content))
+}
+
+func TestFeatures(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go": `{{ if hasFeature "metrics" }}metrics{{ end }}`,
+		`{{ if hasFeature "auth" }}auth.go{{ end }}`: "auth",
+	})
+	for _, test := range []struct {
+		features []string
+		expected []scaffoldertest.File
+	}{
+		{nil, []scaffoldertest.File{
+			{Name: "main.go", Mode: 0o600},
+		}},
+		{[]string{"auth"}, []scaffoldertest.File{
+			{Name: "auth.go", Mode: 0o600, Content: "auth"},
+			{Name: "main.go", Mode: 0o600},
+		}},
+		{[]string{"auth", "metrics"}, []scaffoldertest.File{
+			{Name: "auth.go", Mode: 0o600, Content: "auth"},
+			{Name: "main.go", Mode: 0o600, Content: "metrics"},
+		}},
+	} {
+		dest := t.TempDir()
+		options := []scaffolder.Option{}
+		for _, feature := range test.features {
+			options = append(options, scaffolder.Features(feature))
+		}
+		err := scaffolder.Scaffold(src, dest, nil, options...)
+		assert.NoError(t, err)
+		scaffoldertest.AssertFilesEqual(t, dest, test.expected)
+	}
+}
+
+func TestRequireEmptyDest(t *testing.T) {
+	src := writeTree(t, map[string]string{"README.md": "readme"})
+
+	dest := filepath.Join(t.TempDir(), "new")
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.RequireEmptyDest())
+	assert.NoError(t, err)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.RequireEmptyDest())
+	assert.NoError(t, err)
+
+	dest = writeTree(t, map[string]string{"a": "", "b": "", "c": "", "d": "", "e/f": ""})
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.RequireEmptyDest())
+	assert.IsError(t, err, scaffolder.ErrDestNotEmpty)
+	assert.EqualError(t, err, dest+": destination is not empty, contains a, b, c and 2 more")
+	_, err = os.Stat(filepath.Join(dest, "README.md"))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestWalkDirSkipUnreadableDirs(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions are not enforced")
+	}
+	dir := writeTree(t, map[string]string{
+		"a/file":       "",
+		"unreadable/x": "",
+		"z/file":       "",
+	})
+	unreadable := filepath.Join(dir, "unreadable")
+	assert.NoError(t, os.Chmod(unreadable, 0))
+	t.Cleanup(func() { _ = os.Chmod(unreadable, 0o700) })
+	visit := func(paths *[]string) func(path string, d fs.DirEntry) error {
+		return func(path string, d fs.DirEntry) error {
+			rel, _ := filepath.Rel(dir, path)
+			*paths = append(*paths, filepath.ToSlash(rel))
+			return nil
+		}
+	}
+
+	var paths []string
+	err := scaffolder.WalkDir(dir, visit(&paths))
+	assert.True(t, errors.Is(err, fs.ErrPermission))
+
+	paths = nil
+	var skipped []string
+	err = scaffolder.WalkDir(dir, visit(&paths), scaffolder.SkipUnreadableDirs(func(path string, err error) {
+		skipped = append(skipped, path)
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".", "a", "a/file", "unreadable", "z", "z/file"}, paths)
+	assert.Equal(t, []string{unreadable}, skipped)
+}
+
+func TestWalkDirSkipUnreadableDirsOtherErrors(t *testing.T) {
+	dir := writeTree(t, map[string]string{"gone/x": ""})
+	// Removing the directory once visited but before it is read fails with
+	// an error other than a permission error, which is not skipped.
+	err := scaffolder.WalkDir(dir, func(path string, d fs.DirEntry) error {
+		if filepath.Base(path) == "gone" {
+			return os.RemoveAll(path)
+		}
+		return nil
+	}, scaffolder.SkipUnreadableDirs(nil))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestDiff(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md": "# {{ .Name }}\n\nA service.\n",
+		"main.go":   "package main\n",
+		"new.txt":   "new\n",
+	})
+	dest := writeTree(t, map[string]string{
+		"README.md": "# old\n\nA service.\n",
+		"main.go":   "package main\n",
+		"extra.txt": "untouched\n",
+	})
+	diff, err := scaffolder.Diff(src, dest, map[string]any{"Name": "new"})
+	assert.NoError(t, err)
+	assert.Equal(t, `--- a/README.md
++++ b/README.md
+@@ -1,3 +1,3 @@
+-# old
++# new
+ 
+ A service.
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1,1 @@
++new
+`, diff)
+	_, err = os.Stat(filepath.Join(dest, "new.txt"))
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestDiffExistingDestination(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go": "// Version {{ .Version }}\nfunc init() {\n\t// scaffolder:keep init\n\t// Add initialisation here.\n\t// scaffolder:end\n}\n",
+		"go.mod":  "module app\n",
+	})
+	dest := writeTree(t, map[string]string{
+		"main.go": "// Version 1\nfunc init() {\n\t// scaffolder:keep init\n\tsetup()\n\t// scaffolder:end\n}\n",
+		"go.mod":  "module edited\n",
+	})
+	diff, err := scaffolder.Diff(src, dest, map[string]any{"Version": "2"},
+		scaffolder.ProtectedRegions(),
+		scaffolder.OverwriteOnly("*.go"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, `--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+-// Version 1
++// Version 2
+ func init() {
+ 	// scaffolder:keep init
+ 	setup()
+`, diff)
+
+	src = writeTree(t, map[string]string{"a.txt": "a {{ .Version }}\n", "b.txt": "b {{ .Version }}\n"})
+	dest = t.TempDir()
+	options := []scaffolder.Option{scaffolder.WriteManifest(".scaffolder.json"), scaffolder.OverwriteUnmodified()}
+	assert.NoError(t, scaffolder.Scaffold(src, dest, map[string]any{"Version": "1"}, options...))
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "a.txt"), []byte("edited\n"), 0o600))
+	diff, err = scaffolder.Diff(src, dest, map[string]any{"Version": "2"}, options...)
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "+b 2\n")
+	assert.NotContains(t, diff, "+a 2\n")
+}
+
+func TestPreserveTimes(t *testing.T) {
+	src := writeTree(t, map[string]string{"README.md": "{{ .Name }}"})
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(src, "README.md"), mtime, mtime))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "app"}, scaffolder.PreserveTimes())
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dest, "README.md"))
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(mtime), "%s", info.ModTime())
+
+	out, err := scaffolder.Render(fstest.MapFS{"README.md": {Data: []byte("readme")}}, nil, scaffolder.PreserveTimes())
+	assert.NoError(t, err)
+	info, err = fs.Stat(out, "README.md")
+	assert.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(time.Unix(0, 0)), "%s", info.ModTime())
+}
+
+func TestFixedTime(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md":       "readme",
+		"cmd/app/main.go": "package main",
+		"docs/index.md":   "docs",
+	})
+	fixed := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.FixedTime(fixed), scaffolder.WriteManifest(".scaffolder.json"))
+	assert.NoError(t, err)
+	for _, name := range []string{"README.md", "cmd", "cmd/app", "cmd/app/main.go", "docs", "docs/index.md", ".scaffolder.json"} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().Equal(fixed), "%s: %s", name, info.ModTime())
+	}
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.FixedTime(fixed), scaffolder.PreserveTimes())
+	assert.EqualError(t, err, "FixedTime and PreserveTimes are mutually exclusive")
+}
+
+func TestTemplateManifestModes(t *testing.T) {
+	dest := t.TempDir()
+	err := scaffolder.Scaffold("testdata/inherit-modes/app", dest, nil, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "readme"},
+		{Name: "bin/run", Mode: 0o750, Content: "#!/bin/sh"},
+		{Name: "scripts/build", Mode: 0o755, Content: "#!/bin/sh"},
+		{Name: "setup.sh", Mode: 0o755, Content: "#!/bin/sh"},
+	})
+
+	src := writeTree(t, map[string]string{"scaffolder.yaml": "modes:\n  '*.sh': rwx\n"})
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid mode "rwx" for "*.sh"`)
+}
+
+func TestSliceContext(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ range . }}{{ push .name . }}{{ end }}/README.md": "# {{ .name }}",
+		"index.md":  "{{ range $ }}- {{ .name }}\n{{ end }}",
+		"count.txt": "{{ len . }} {{ (index . 0).name }}",
+	})
+	dest := t.TempDir()
+	ctx := []any{map[string]any{"name": "api"}, map[string]any{"name": "worker"}}
+	err := scaffolder.Scaffold(src, dest, ctx)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "api/README.md", Mode: 0o600, Content: "# api"},
+		{Name: "count.txt", Mode: 0o600, Content: "2 api"},
+		{Name: "index.md", Mode: 0o600, Content: "- api\n- worker\n"},
+		{Name: "worker/README.md", Mode: 0o600, Content: "# worker"},
+	})
+}
+
+func TestAllowFunctions(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"out":     `{{ .Name | upper }} {{ len .Name }}`,
+		"partial": "partial",
+	})
+	dest := t.TempDir()
+	options := []scaffolder.Option{
+		scaffolder.Exclude("^partial$"),
+		scaffolder.Functions(scaffolder.FuncMap{"upper": strings.ToUpper, "exec": func() string { return "pwned" }}),
+		scaffolder.AllowFunctions("upper"),
+	}
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "app"}, options...)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "out", Mode: 0o600, Content: "APP 3"},
+	})
+
+	names, err := scaffolder.ListFunctions(src, nil, options...)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"upper"}, names)
+
+	for _, tmpl := range []string{`{{ exec }}`, `{{ include "partial" . }}`, `{{ sha256 "x" }}`} {
+		assert.NoError(t, os.WriteFile(filepath.Join(src, "out"), []byte(tmpl), 0o600))
+		err = scaffolder.Scaffold(src, t.TempDir(), nil, options...)
+		assert.Error(t, err, "%s", tmpl)
+		assert.Contains(t, err.Error(), "is not allowed", "%s", tmpl)
+	}
+
+	assert.NoError(t, os.WriteFile(filepath.Join(src, "out"), []byte(`{{ undefined }}`), 0o600))
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, options...)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "is not allowed")
+}
+
+func TestGitkeep(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"full/main.go": "package main",
+		"skipped/old":  "old",
+	})
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "empty", "nested"), 0o700))
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "existing"), 0o700))
+	dest := writeTree(t, map[string]string{"existing/kept": "kept"})
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Gitkeep(), scaffolder.Exclude("^skipped/old$"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "empty/nested/.gitkeep", Mode: 0o600},
+		{Name: "existing/kept", Mode: 0o600, Content: "kept"},
+		{Name: "full/main.go", Mode: 0o600, Content: "package main"},
+		{Name: "skipped/.gitkeep", Mode: 0o600},
+	})
+
+	dest = t.TempDir()
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.GitkeepName(".keep"), scaffolder.Exclude("^skipped/old$"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dest, "empty", "nested", ".keep"))
+	assert.NoError(t, err)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.GitkeepName("a/b"))
+	assert.Error(t, err)
+}
+
+type upperEngine struct{}
+
+func (upperEngine) Parse(path, tmpl string, funcs scaffolder.FuncMap) (any, error) {
+	return tmpl, nil
+}
+
+func (upperEngine) Execute(w io.Writer, parsed any, ctx any) error {
+	_, err := io.WriteString(w, strings.ToUpper(parsed.(string)))
+	return err
+}
+
+func TestWithEngine(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"docs/readme.md": "hello {{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "app"}, scaffolder.WithEngine(upperEngine{}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "DOCS/README.MD", Mode: 0o600, Content: "HELLO {{ .NAME }}"},
+	})
+}
+
+func TestRecordTo(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md":        "# {{ .Name }}",
+		"{{ .Name }}/a.go": "package {{ .Name }}",
+		"{{ .Name }}/b.go": "package {{ .Name }}",
+	})
+	assert.NoError(t, os.Symlink("README.md", filepath.Join(src, "link")))
+	ctx := map[string]any{"Name": "app"}
+	record := func() string {
+		t.Helper()
+		out := &strings.Builder{}
+		err := scaffolder.Scaffold(src, t.TempDir(), ctx, scaffolder.RecordTo(out))
+		assert.NoError(t, err)
+		return out.String()
+	}
+	first := record()
+	assert.Equal(t, first, record())
+	assert.Equal(t, strings.Join([]string{
+		`{"op":"write","path":"README.md","mode":"0600","sha256":"bdd1532dfe7b469d686667468d3c71e927e595f847bb01fc670b0e1626acc26f"}`,
+		`{"op":"mkdir","path":"app","mode":"0700"}`,
+		`{"op":"write","path":"app/a.go","mode":"0600","sha256":"e26155e2bbbbe3f944639b9e83dd82c1bbc76391abf95fff106e14d4159a84f3"}`,
+		`{"op":"write","path":"app/b.go","mode":"0600","sha256":"e26155e2bbbbe3f944639b9e83dd82c1bbc76391abf95fff106e14d4159a84f3"}`,
+		`{"op":"symlink","path":"link","target":"README.md"}`,
+	}, "\n")+"\n", first)
+}
+
+func TestRecordToPush(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ range .Names }}{{ push . . }}{{ end }}/name.txt": "{{ . }}",
+	})
+	ctx := map[string]any{"Names": []string{"e", "b", "d", "a", "c"}}
+	records := []string{}
+	for range 5 {
+		out := &strings.Builder{}
+		err := scaffolder.Scaffold(src, t.TempDir(), ctx, scaffolder.RecordTo(out))
+		assert.NoError(t, err)
+		records = append(records, out.String())
+	}
+	for _, record := range records[1:] {
+		assert.Equal(t, records[0], record)
+	}
+	paths := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(records[0]), "\n") {
+		var op struct{ Path string }
+		assert.NoError(t, json.Unmarshal([]byte(line), &op))
+		paths = append(paths, op.Path)
+	}
+	assert.Equal(t, []string{"e", "e/name.txt", "b", "b/name.txt", "d", "d/name.txt", "a", "a/name.txt", "c", "c/name.txt"}, paths)
+}
+
+func TestMaxDepth(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md":             "readme",
+		"cmd/main.go":           "package main",
+		"cmd/app/app.go":        "package app",
+		"cmd/app/internal/x.go": "package internal",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.MaxDepth(2))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "readme"},
+		{Name: "cmd/main.go", Mode: 0o600, Content: "package main"},
+	})
+	info, err := os.Stat(filepath.Join(dest, "cmd", "app"))
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = os.Stat(filepath.Join(dest, "cmd", "app", "internal"))
+	assert.IsError(t, err, fs.ErrNotExist)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.MaxDepth(0))
+	assert.Error(t, err)
+}
+
+func TestIsBinary(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"notes.txt": "{{ .Name }}",
+		"image.bin": "\x00{{ .Name }}",
+		"README.md": "{{ .Name }}",
+		"sub/a.txt": "{{ .Name }}",
+	})
+	ctx := map[string]any{"Name": "app"}
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, ctx)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "app"},
+		{Name: "image.bin", Mode: 0o600, Content: "\x00{{ .Name }}"},
+		{Name: "notes.txt", Mode: 0o600, Content: "app"},
+		{Name: "sub/a.txt", Mode: 0o600, Content: "app"},
+	})
+
+	paths := []string{}
+	dest = t.TempDir()
+	err = scaffolder.Scaffold(src, dest, ctx, scaffolder.IsBinary(func(path string, head []byte) bool {
+		paths = append(paths, path)
+		return filepath.Ext(path) == ".txt"
+	}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "app"},
+		{Name: "image.bin", Mode: 0o600, Content: "\x00app"},
+		{Name: "notes.txt", Mode: 0o600, Content: "{{ .Name }}"},
+		{Name: "sub/a.txt", Mode: 0o600, Content: "{{ .Name }}"},
+	})
+	assert.Equal(t, []string{"README.md", "image.bin", "notes.txt", filepath.Join("sub", "a.txt")}, paths)
+}
+
+func TestSymlinkToPushedDir(t *testing.T) {
+	src := t.TempDir()
+	dir := filepath.Join(src, "{{ range .Services }}{{ push . $ }}{{ end }}")
+	assert.NoError(t, os.MkdirAll(dir, 0o700))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0o600))
+	assert.NoError(t, os.Symlink("{{ push .Current . }}", filepath.Join(src, "current")))
+	dest := t.TempDir()
+	ctx := map[string]any{"Services": []string{"api", "web"}, "Current": "web"}
+	err := scaffolder.Scaffold(src, dest, ctx)
+	assert.NoError(t, err)
+	target, err := os.Readlink(filepath.Join(dest, "current"))
+	assert.NoError(t, err)
+	assert.Equal(t, "web", target)
+	content, err := os.ReadFile(filepath.Join(dest, "current", "main.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+	_, err = os.Stat(filepath.Join(dest, "api", "main.go"))
+	assert.NoError(t, err)
+
+	ctx["Current"] = "worker"
+	err = scaffolder.Scaffold(src, t.TempDir(), ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `symlink target "worker" does not exist after scaffolding`)
+}
+
+func TestScaffoldFunction(t *testing.T) {
+	lib, err := filepath.Abs("testdata/compose/lib")
+	assert.NoError(t, err)
+	dest := t.TempDir()
+	err = scaffolder.Scaffold("testdata/compose/app", dest, map[string]any{"Name": "app", "Lib": lib})
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "LICENSE", Mode: 0o600, Content: "Copyright app"},
+		{Name: "README.md", Mode: 0o600, Content: "# app\n"},
+		{Name: "docs/guide.md", Mode: 0o600, Content: "guide"},
+		{Name: "sub/lib.go", Mode: 0o600, Content: "package app"},
+	})
+
+	err = scaffolder.Scaffold("testdata/compose-cycle/a", t.TempDir(), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cycle detected")
+}
+
+func TestScaffoldFunctionInherited(t *testing.T) {
+	dest := t.TempDir()
+	// The base template's scaffold call resolves relative to the base
+	// template, not the app template that extends it.
+	err := scaffolder.Scaffold("testdata/compose-inherit/app", dest, map[string]any{"Name": "app"}, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "LICENSE", Mode: 0o600, Content: "Copyright app"},
+		{Name: "README.md", Mode: 0o600, Content: "# app"},
+		{Name: "main.go", Mode: 0o600, Content: "package app"},
+	})
+}
+
+func TestOnSkip(t *testing.T) {
+	dest := writeTree(t, map[string]string{"main.go": "package edited"})
+	skipped := []scaffolder.Skip{}
+	err := scaffolder.Scaffold("testdata/skip", dest, map[string]any{"Docs": false},
+		scaffolder.Exclude(`\.env$`, "^tmp$"),
+		scaffolder.OverwriteOnly("*.md"),
+		scaffolder.OnSkip(func(skip scaffolder.Skip) { skipped = append(skipped, skip) }),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []scaffolder.Skip{
+		{Path: "logo.png", Destination: filepath.Join(dest, "logo.png"), Reason: scaffolder.SkipBinaryCopied},
+		{Path: "main.go", Destination: filepath.Join(dest, "main.go"), Reason: scaffolder.SkipConflict},
+		{Path: "secrets.env", Reason: scaffolder.SkipExcludedByPattern},
+		{Path: "tmp", Reason: scaffolder.SkipExcludedByPattern},
+		{Path: "{{ if .Docs }}docs{{ end }}", Reason: scaffolder.SkipEmptyName},
+	}, skipped)
+}
+
+func TestIncludeDotfiles(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		".DS_Store":      "clutter",
+		".git/HEAD":      "ref: refs/heads/main",
+		"pkg/.DS_Store":  "clutter",
+		"pkg/.gitignore": "*.o",
+		"pkg/main.go":    "package main",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.IncludeDotfiles(false))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "pkg/main.go", Mode: 0o600, Content: "package main"},
+	})
+
+	dest = t.TempDir()
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.IncludeDotfiles(true))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: ".DS_Store", Mode: 0o600, Content: "clutter"},
+		{Name: ".git/HEAD", Mode: 0o600, Content: "ref: refs/heads/main"},
+		{Name: "pkg/.DS_Store", Mode: 0o600, Content: "clutter"},
+		{Name: "pkg/.gitignore", Mode: 0o600, Content: "*.o"},
+		{Name: "pkg/main.go", Mode: 0o600, Content: "package main"},
+	})
+}
+
+func TestScaffoldThroughSymlinkedDir(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"linked/file.txt": "{{ .Name }}",
+	})
+	dest := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dest, "real"), 0o700))
+	assert.NoError(t, os.Symlink("real", filepath.Join(dest, "linked")))
+
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"})
+	assert.NoError(t, err)
+	info, err := os.Lstat(filepath.Join(dest, "linked"))
+	assert.NoError(t, err)
+	assert.True(t, info.Mode()&os.ModeSymlink != 0, "symlink should be preserved")
+	content, err := os.ReadFile(filepath.Join(dest, "real", "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test", string(content))
+}
+
+func TestScaffoldOverFileIsError(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"dir/file.txt": "",
+	})
+	dest := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "dir"), nil, 0o600))
+	err := scaffolder.Scaffold(src, dest, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "is not a directory")
+}
+
+func TestFollowSourceSymlinks(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"real/file.txt": "{{ .Name }}",
+	})
+	assert.NoError(t, os.Symlink("real", filepath.Join(src, "linked")))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"}, scaffolder.FollowSourceSymlinks())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "linked/file.txt", Mode: 0o600, Content: "test"},
+		{Name: "real/file.txt", Mode: 0o600, Content: "test"},
+	})
+	info, err := os.Lstat(filepath.Join(dest, "linked"))
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir(), "symlink should be copied as a directory")
+}
+
+func TestFollowSourceSymlinksCycle(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"dir/file.txt": "",
+	})
+	assert.NoError(t, os.Symlink("..", filepath.Join(src, "dir", "loop")))
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.FollowSourceSymlinks())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "symlink cycle detected")
+}
+
+func TestTemplatedSymlinkTargets(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Dir }}/file.txt": "{{ .Name }}",
+	})
+	assert.NoError(t, os.Mkdir(filepath.Join(src, "links"), 0o700))
+	assert.NoError(t, os.Symlink("../{{ .Dir }}/file.txt", filepath.Join(src, "links", "relative")))
+	assert.NoError(t, os.Symlink("{{ .Root }}/{{ .Dir }}/file.txt", filepath.Join(src, "links", "absolute")))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test", "Dir": "generated", "Root": dest})
+	assert.NoError(t, err)
+	for _, name := range []string{"relative", "absolute"} {
+		target, err := os.Readlink(filepath.Join(dest, "links", name))
+		assert.NoError(t, err)
+		assert.Equal(t, filepath.Join("..", "generated", "file.txt"), target, name)
+	}
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "generated/file.txt", Mode: 0o600, Content: "test"},
+		{Name: "links/absolute", Mode: 0o700 | os.ModeSymlink, Content: "test"},
+		{Name: "links/relative", Mode: 0o700 | os.ModeSymlink, Content: "test"},
+	})
+}
+
+func TestMaxFileSize(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"small.txt": "{{ .Name }}",
+		"large.txt": "{{ range .List }}{{ . }}{{ end }}",
+	})
+	list := make([]string, 1024)
+	for i := range list {
+		list[i] = "0123456789"
+	}
+	err := scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Name": "test", "List": list}, scaffolder.MaxFileSize(1024))
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, scaffolder.ErrFileTooLarge), "%v", err)
+	assert.Contains(t, err.Error(), filepath.Join(src, "large.txt"))
+}
+
+func TestScaffoldContextCancel(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"a.txt": "{{ cancel }}",
+		"b.txt": "",
+	})
+	dest := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := scaffolder.ScaffoldContext(ctx, src, dest, nil, scaffolder.Functions(scaffolder.FuncMap{
+		"cancel": func() string {
+			cancel()
+			return ""
+		},
+	}))
+	assert.True(t, errors.Is(err, context.Canceled), "%v", err)
+	_, err = os.Stat(filepath.Join(dest, "b.txt"))
+	assert.True(t, os.IsNotExist(err), "b.txt should not have been scaffolded")
+}
+
+func TestAfterEachEntry(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"bin/script.sh": "#!/bin/sh\n",
+		"bin/README":    "",
+	})
+	assert.NoError(t, os.Chmod(filepath.Join(src, "bin", "script.sh"), 0o700))
+	assert.NoError(t, os.Symlink("bin/script.sh", filepath.Join(src, "run")))
+	dest := t.TempDir()
+	kinds := map[string]scaffolder.EntryKind{}
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.AfterEachEntry(func(path string, info fs.FileInfo, kind scaffolder.EntryKind) error {
+		rel, _ := filepath.Rel(dest, path)
+		kinds[rel] = kind
+		if kind == scaffolder.EntryFile && info.Mode()&0o100 != 0 {
+			return os.Chmod(path, 0o500)
+		}
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]scaffolder.EntryKind{
+		"bin":           scaffolder.EntryDir,
+		"bin/README":    scaffolder.EntryFile,
+		"bin/script.sh": scaffolder.EntryFile,
+		"run":           scaffolder.EntrySymlink,
+	}, kinds)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "bin/README", Mode: 0o600},
+		{Name: "bin/script.sh", Mode: 0o500, Content: "#!/bin/sh\n"},
+		{Name: "run", Mode: 0o700 | os.ModeSymlink, Content: "#!/bin/sh\n"},
+	})
+}
+
+func TestExecutableShebang(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"run.sh":    "#!/bin/sh\necho {{ .Name }}\n",
+		"notes.txt": "{{ .Name }}",
+	})
+	assert.NoError(t, os.Chmod(filepath.Join(src, "run.sh"), 0o644))
+	assert.NoError(t, os.Chmod(filepath.Join(src, "notes.txt"), 0o644))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"}, scaffolder.ExecutableShebang())
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dest, "run.sh"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	info, err = os.Stat(filepath.Join(dest, "notes.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+}
+
+func TestEmptyDirectoryNamePrunesSubtree(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ if .Include }}optional{{ end }}/{{ visit }}file.txt":        "{{ visit }}",
+		"{{ if .Include }}optional{{ end }}/nested/{{ visit }}file.txt": "{{ visit }}",
+		"kept.txt": "",
+	})
+	visits := 0
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Include": false}, scaffolder.Functions(scaffolder.FuncMap{
+		"visit": func() string {
+			visits++
+			return ""
+		},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, visits)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "kept.txt", Mode: 0o600},
+	})
+}
+
+func TestCollect(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		`models/{{ range .Models }}{{ push (print . ".go") . }}{{ collect "models" . }}{{ end }}`: "type {{ . }} struct{}",
+		"registry.go": `var models = []any{ {{- range $i, $m := collected "models" }}{{ if $i }}, {{ end }}{{ $m }}{}{{ end -}} }`,
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Models": []string{"User", "Order"}}, scaffolder.Collect())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "models/Order.go", Mode: 0o600, Content: "type Order struct{}"},
+		{Name: "models/User.go", Mode: 0o600, Content: "type User struct{}"},
+		{Name: "registry.go", Mode: 0o600, Content: "var models = []any{User{}, Order{}}"},
+	})
+}
+
+func TestSiblings(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"index.ts.tmpl": `{{ range siblings }}import "./{{ . }}";{{ end }}`,
+		"{{ range .Modules }}{{ push (print . \".ts\") . }}{{ end }}": "export const name = {{ printf \"%q\" . }};",
+		"nested/other.ts": "",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Modules": []string{"b", "a"}}, scaffolder.Siblings())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "a.ts", Mode: 0o600, Content: `export const name = "a";`},
+		{Name: "b.ts", Mode: 0o600, Content: `export const name = "b";`},
+		{Name: "index.ts", Mode: 0o600, Content: `import "./a.ts";import "./b.ts";import "./nested";`},
+		{Name: "nested/other.ts", Mode: 0o600},
+	})
+}
+
+func TestChmodDirective(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"secret.txt": "{{ chmod 0600 }}{{ .Secret }}",
+		"run.sh":     "{{ chmod 0755 }}#!/bin/sh\n",
+	})
+	assert.NoError(t, os.Chmod(filepath.Join(src, "secret.txt"), 0o644))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Secret": "hunter2"})
+	assert.NoError(t, err)
+	for name, mode := range map[string]os.FileMode{"secret.txt": 0o600, "run.sh": 0o755} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		assert.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), name)
+	}
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "run.sh", Mode: 0o700, Content: "#!/bin/sh\n"},
+		{Name: "secret.txt", Mode: 0o600, Content: "hunter2"},
+	})
+}
+
+func TestRender(t *testing.T) {
+	source := fstest.MapFS{
+		"regular-{{ .Name }}.tmpl":                         {Data: []byte("Hello, {{ .Name }}!"), Mode: 0o600},
+		"{{ range .List }}{{ push . . }}{{ end }}/{{ . }}": {Data: []byte("{{ . }}"), Mode: 0o600},
+		"{{ if .Include }}excluded{{ end }}/file":          {Data: []byte("excluded"), Mode: 0o600},
+	}
+	output, err := scaffolder.Render(source, map[string]any{
+		"Name":    "test",
+		"List":    []string{"first", "second"},
+		"Include": false,
+	})
+	assert.NoError(t, err)
+	files := map[string]string{}
+	err = fs.WalkDir(output, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(output, path)
+		files[path] = string(content)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"regular-test":  "Hello, test!",
+		"first/first":   "first",
+		"second/second": "second",
+	}, files)
+}
+
+func TestRootExclude(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.scaffold.md":        "meta",
+		"README.md":                 "readme",
+		"nested/README.scaffold.md": "content",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.RootExclude("*.scaffold.md"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "readme"},
+		{Name: "nested/README.scaffold.md", Mode: 0o600, Content: "content"},
+	})
+}
+
+func TestContentFilter(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}.txt": "hello {{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"},
+		scaffolder.ContentFilter(func(path, content string) (string, error) {
+			return strings.ToUpper(content), nil
+		}),
+		scaffolder.ContentFilter(func(path, content string) (string, error) {
+			return content + "\n", nil
+		}),
+	)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "test.txt", Mode: 0o600, Content: "HELLO TEST\n"},
+	})
+}
+
+func TestTransform(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go":       "package main\n\nfunc main() {\n}",
+		"web/app.ts":    "const x = 1",
+		"README.md":     "# readme",
+		"web/styles.go": "package web",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil,
+		scaffolder.Transform("*.go", func(content string) (string, error) {
+			out, err := format.Source([]byte(content))
+			return string(out), err
+		}),
+		scaffolder.Transform("web/*.ts", func(content string) (string, error) {
+			return content + ";\n", nil
+		}),
+		scaffolder.Transform("*.go", func(content string) (string, error) {
+			return "// Code generated by scaffolder.\n\n" + content, nil
+		}),
+	)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "# readme"},
+		{Name: "main.go", Mode: 0o600, Content: "// Code generated by scaffolder.\n\npackage main\n\nfunc main() {\n}\n"},
+		{Name: "web/app.ts", Mode: 0o600, Content: "const x = 1;\n"},
+		{Name: "web/styles.go", Mode: 0o600, Content: "// Code generated by scaffolder.\n\npackage web\n"},
+	})
+}
+
+func TestBanner(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go":   "package main\n",
+		"run.sh":    "#!/bin/sh\necho hello\n",
+		"page.html": "<p></p>\n",
+		"data.bin":  "data",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Banner("Code generated by scaffolder.\nDO NOT EDIT."))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "data.bin", Mode: 0o600, Content: "data"},
+		{Name: "main.go", Mode: 0o600, Content: "// Code generated by scaffolder.\n// DO NOT EDIT.\npackage main\n"},
+		{Name: "page.html", Mode: 0o600, Content: "<!-- Code generated by scaffolder. -->\n<!-- DO NOT EDIT. -->\n<p></p>\n"},
+		{Name: "run.sh", Mode: 0o600, Content: "#!/bin/sh\n# Code generated by scaffolder.\n# DO NOT EDIT.\necho hello\n"},
+	})
+}
+
+func TestPushFrom(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"variants/go/main.go":   "package {{ .Name }}\n",
+		"variants/ts/index.ts":  "export const name = '{{ .Name }}';\n",
+		"variants/ts/README.md": "{{ .Name }}",
+	})
+	assert.NoError(t, os.Mkdir(filepath.Join(src, "{{ range .Plugins }}{{ pushFrom .Name .Template . }}{{ end }}"), 0o700))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{
+		"Plugins": []map[string]string{
+			{"Name": "alpha", "Template": "variants/go"},
+			{"Name": "beta", "Template": "variants/ts"},
+		},
+	}, scaffolder.Exclude("^variants", "^README.md$"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "alpha/main.go", Mode: 0o600, Content: "package alpha\n"},
+		{Name: "beta/index.ts", Mode: 0o600, Content: "export const name = 'beta';\n"},
+	})
+}
+
+func TestListFunctions(t *testing.T) {
+	names, err := scaffolder.ListFunctions(t.TempDir(), nil,
+		scaffolder.Functions(scaffolder.FuncMap{"custom": strings.ToUpper}),
+		scaffolder.Extend(scaffolder.ExtensionFunc(func(mutableConfig *scaffolder.Config) error {
+			mutableConfig.Funcs["extended"] = strings.ToLower
+			return nil
+		})),
+	)
+	assert.NoError(t, err)
+	assert.True(t, slices.IsSorted(names))
+	for _, name := range []string{"custom", "extended", "push", "toJson"} {
+		assert.True(t, slices.Contains(names, name), name)
+	}
+}
+
+func TestLint(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"valid.txt":             "{{ .Name }}",
+		"{{ .Name }}/ok.txt":    "ok",
+		"{{ .Name }}/broken.go": "{{ .Name ",
+	})
+	errs := scaffolder.Lint(src, map[string]any{"Name": "test"})
+	assert.Equal(t, 1, len(errs), "%v", errs)
+	assert.Contains(t, errs[0].Error(), "broken.go")
+}
+
+func TestLintTemplateManifestExtends(t *testing.T) {
+	errs := scaffolder.Lint("testdata/inherit-lint/app", map[string]any{"Name": "test"}, scaffolder.TemplateManifest("scaffolder.yaml"))
+	assert.Equal(t, 1, len(errs), "%v", errs)
+	assert.Contains(t, errs[0].Error(), filepath.Join("base", "broken.txt"))
+}
+
+func TestLintSymlinkOrder(t *testing.T) {
+	src := writeTree(t, map[string]string{})
+	for _, name := range []string{"c", "a", "b", "d"} {
+		// A pushed target that is never generated fails once symlinks are
+		// applied.
+		assert.NoError(t, os.Symlink(`{{ push "missing" . }}`, filepath.Join(src, name)))
+	}
+	errs := scaffolder.Lint(src, nil)
+	assert.Equal(t, 4, len(errs), "%v", errs)
+	for i, name := range []string{"a", "b", "c", "d"} {
+		assert.Contains(t, errs[i].Error(), " "+name+": ")
+	}
+}
+
+func TestReferencedVars(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}.txt":               "{{ range .List }}{{ .Nested }}{{ $.Root }}{{ end }}",
+		"{{ if .Flag }}x{{ end }}/file": "{{ with .Config }}{{ .Nested }}{{ else }}{{ .Fallback }}{{ end }}",
+		"excluded":                      "{{ .Excluded }}",
+	})
+	vars, err := scaffolder.ReferencedVars(src, scaffolder.Exclude("^excluded$"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Config", "Fallback", "Flag", "List", "Name", "Root"}, vars)
+}
+
+func TestReferencedVarsSkipsVerbatimFiles(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}.bin":   "\x00{{ .Binary",
+		"page.txt.mustache": "{{ .Mustache }} {{#items}}{{/items}}",
+	})
+	render := func(path, tmpl string, ctx any) (string, error) { return tmpl, nil }
+	vars, err := scaffolder.ReferencedVars(src, scaffolder.Extend(scaffolder.ExtensionFunc(func(config *scaffolder.Config) error {
+		config.AddRenderer(".mustache", render)
+		return nil
+	})))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Name"}, vars)
+}
+
+func TestInclude(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"partials/header.txt": "# {{ .Title }}",
+		"page.txt":            `{{ include "partials/header.txt" .Page }}`,
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Page": map[string]any{"Title": "Hello"}}, scaffolder.Exclude("^partials"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "page.txt", Mode: 0o600, Content: "# Hello"},
+	})
+}
+
+func TestIncludeCycle(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"partials/a.txt": `{{ include "partials/b.txt" . }}`,
+		"partials/b.txt": `{{ include "partials/a.txt" . }}`,
+		"page.txt":       `{{ include "partials/a.txt" . }}`,
+	})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Exclude("^partials"), scaffolder.MaxIncludeDepth(4))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "include cycle detected: page.txt -> partials/a.txt -> partials/b.txt -> partials/a.txt -> partials/b.txt -> partials/a.txt")
+}
+
+func TestIncludeRecursive(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"partials/node.txt": `{{ .Name }}{{ range .Children }}({{ include "partials/node.txt" . }}){{ end }}`,
+		"tree.txt":          `{{ include "partials/node.txt" .Tree }}`,
+	})
+	leaf := func(name string) map[string]any { return map[string]any{"Name": name} }
+	tree := map[string]any{"Name": "a", "Children": []any{
+		map[string]any{"Name": "b", "Children": []any{leaf("c")}},
+		leaf("d"),
+	}}
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Tree": tree}, scaffolder.Exclude("^partials"))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "tree.txt", Mode: 0o600, Content: "a(b(c))(d)"},
+	})
+}
+
+func TestTpl(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"greeting.txt": `{{ tpl .Greeting . }}`,
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Greeting": `Hello {{ .Name | upper }}`, "Name": "alice"},
+		scaffolder.Functions(scaffolder.FuncMap{"upper": strings.ToUpper}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "greeting.txt", Mode: 0o600, Content: "Hello ALICE"},
+	})
+}
+
+func TestTplRecursion(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"loop.txt": `{{ tpl .Loop . }}`,
+	})
+	err := scaffolder.Scaffold(src, t.TempDir(), map[string]any{"Loop": `{{ tpl .Loop . }}`}, scaffolder.MaxIncludeDepth(3))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "maximum include depth of 3 exceeded: loop.txt -> tpl -> tpl -> tpl -> tpl")
+}
+
+func TestFrontMatter(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"page.md": "---\nTitle: Welcome\nSite: override\n---\n# {{ .Title }} to {{ .Site }} by {{ .Author }}\n",
+		"doc.md":  "# {{ .Site }}\n",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Site": "global", "Author": "Alice"}, scaffolder.FrontMatter())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "doc.md", Mode: 0o600, Content: "# global\n"},
+		{Name: "page.md", Mode: 0o600, Content: "# Welcome to override by Alice\n"},
+	})
+}
+
+func TestWriteManifest(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"hello.txt":   "hello",
+		"pkg/main.go": "package main",
+		"empty/.keep": "",
+		"link-target": "target",
+	})
+	assert.NoError(t, os.Symlink("link-target", filepath.Join(src, "link")))
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.WriteManifest(".scaffolder/manifest.json"))
+	assert.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dest, ".scaffolder/manifest.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "files": [
+    {
+      "path": "../empty/.keep",
+      "sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+    },
+    {
+      "path": "../hello.txt",
+      "sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+    },
+    {
+      "path": "../link-target",
+      "sha256": "34a04005bcaf206eec990bd9637d9fdb6725e0a0c0d4aebf003f17f4c956eb5c"
+    },
+    {
+      "path": "../pkg/main.go",
+      "sha256": "512843855fcc92a51c810b1b58e0731c01eac9a6a23c157bfa02aad71edffbe7"
+    }
+  ]
+}
+`, string(data))
+}
+
+func TestClean(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"hello.txt":       "hello",
+		"pkg/main.go":     "package main",
+		"edited/notes.md": "notes",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.WriteManifest("manifest.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "edited/notes.md"), []byte("my notes"), 0o600))
+
+	err = scaffolder.Clean(filepath.Join(dest, "manifest.json"))
+	assert.EqualError(t, err, filepath.Join(dest, "edited/notes.md")+": modified since it was generated")
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "edited/notes.md", Mode: 0o600, Content: "my notes"},
+		{Name: "manifest.json", Mode: 0o600, Content: `{
+  "files": [
+    {
+      "path": "edited/notes.md",
+      "sha256": "ab5aa97074c454a0632057e704220d9a6678fbf773a0a5806fc09b8173b07309"
+    },
+    {
+      "path": "hello.txt",
+      "sha256": "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+    },
+    {
+      "path": "pkg/main.go",
+      "sha256": "512843855fcc92a51c810b1b58e0731c01eac9a6a23c157bfa02aad71edffbe7"
+    }
+  ]
+}
+`},
+	})
+	_, err = os.Stat(filepath.Join(dest, "pkg"))
+	assert.True(t, os.IsNotExist(err), "empty directory should be removed")
+
+	assert.NoError(t, os.Remove(filepath.Join(dest, "edited/notes.md")))
+	assert.NoError(t, scaffolder.Clean(filepath.Join(dest, "manifest.json")))
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{})
+}
+
+func TestOverwriteUnmodified(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"generated.txt": "version {{ .Version }}",
+		"edited.txt":    "version {{ .Version }}",
+		"existing.txt":  "version {{ .Version }}",
+	})
+	dest := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "existing.txt"), []byte("mine"), 0o600))
+	options := []scaffolder.Option{scaffolder.WriteManifest("manifest.json"), scaffolder.OverwriteUnmodified()}
+
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Version": 1}, options...)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dest, "edited.txt"), []byte("my edits"), 0o600))
+
+	for _, version := range []int{2, 3} {
+		err = scaffolder.Scaffold(src, dest, map[string]any{"Version": version}, options...)
+		assert.NoError(t, err)
+		files := map[string]string{}
+		for _, name := range []string{"generated.txt", "edited.txt", "existing.txt"} {
+			data, err := os.ReadFile(filepath.Join(dest, name))
+			assert.NoError(t, err)
+			files[name] = string(data)
+		}
+		assert.Equal(t, map[string]string{
+			"generated.txt": fmt.Sprintf("version %d", version),
+			"edited.txt":    "my edits",
+			"existing.txt":  "mine",
+		}, files)
+	}
+
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.OverwriteUnmodified())
+	assert.EqualError(t, err, "OverwriteUnmodified requires WriteManifest")
+}
+
+func TestApplyModes(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"build.sh":          "#!/bin/sh",
+		"scripts/deploy.sh": "#!/bin/sh",
+		"scripts/secret.sh": "#!/bin/sh",
+		"README.md":         "# readme",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.ApplyModes(map[string]os.FileMode{
+		"*.sh":              0o755,
+		"scripts/secret.sh": 0o700,
+	}))
+	assert.NoError(t, err)
+	for name, mode := range map[string]os.FileMode{
+		"build.sh":          0o755,
+		"scripts/deploy.sh": 0o755,
+		"scripts/secret.sh": 0o700,
+		"README.md":         0o600,
+	} {
+		info, err := os.Stat(filepath.Join(dest, name))
+		assert.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), name)
+	}
+}
+
+func TestApplyModesTie(t *testing.T) {
+	src := writeTree(t, map[string]string{"a/run.sh": "#!/bin/sh"})
+	modes := scaffolder.ApplyModes(map[string]os.FileMode{
+		"*.sh": 0o755,
+		"a/*h": 0o700,
+	})
+	// Both patterns have the same length, so the lexically first wins on
+	// every run.
+	for range 10 {
+		dest := t.TempDir()
+		assert.NoError(t, scaffolder.Scaffold(src, dest, nil, modes))
+		info, err := os.Stat(filepath.Join(dest, "a", "run.sh"))
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm())
+	}
+}
+
+func TestConfigAddFile(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"a.txt": "a",
+		"b.txt": "b",
+	})
+	dest := t.TempDir()
+	var config *scaffolder.Config
+	count := 0
+	err := scaffolder.Scaffold(src, dest, nil,
+		scaffolder.Extend(scaffolder.ExtensionFunc(func(mutableConfig *scaffolder.Config) error {
+			config = mutableConfig
+			return mutableConfig.AddFile("excluded.txt", nil, 0o600)
+		})),
+		scaffolder.AfterEach(func(path string) error {
+			count++
+			if count == 2 {
+				return config.AddFile("meta/count.txt", []byte(fmt.Sprint(count)), 0o600)
+			}
+			return nil
+		}),
+		scaffolder.Exclude("^excluded.txt$"),
+	)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "a.txt", Mode: 0o600, Content: "a"},
+		{Name: "b.txt", Mode: 0o600, Content: "b"},
+		{Name: "meta/count.txt", Mode: 0o600, Content: "2"},
+	})
+}
+
+func TestConfigAddFileConflict(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"a.txt": "a",
+	})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil,
+		scaffolder.Extend(scaffolder.ExtensionFunc(func(mutableConfig *scaffolder.Config) error {
+			return mutableConfig.AddFile("a.txt", nil, 0o600)
+		})),
+	)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "conflicts with a scaffolded file")
+}
+
+func TestFunctionsStrict(t *testing.T) {
+	src := writeTree(t, map[string]string{"a.txt": "{{ custom }}"})
+	custom := func() string { return "custom" }
+	err := scaffolder.Scaffold(src, t.TempDir(), nil,
+		scaffolder.Functions(scaffolder.FuncMap{"custom": custom}),
+		scaffolder.FunctionsStrict(scaffolder.FuncMap{"custom": custom}),
+	)
+	assert.EqualError(t, err, `function "custom" is already defined`)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.FunctionsStrict(scaffolder.FuncMap{"toJson": custom}))
+	assert.EqualError(t, err, `function "toJson" is already defined`)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Functions(scaffolder.FuncMap{"push": custom}))
+	assert.EqualError(t, err, `function "push" is reserved and can't be overridden`)
+
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Functions(scaffolder.FuncMap{"scaffold": custom}))
+	assert.EqualError(t, err, `function "scaffold" is reserved and can't be overridden`)
+
+	dest := t.TempDir()
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.FunctionsStrict(scaffolder.FuncMap{"custom": custom}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "a.txt", Mode: 0o600, Content: "custom"},
+	})
+}
+
+func TestTypedErrors(t *testing.T) {
+	t.Run("Template", func(t *testing.T) {
+		src := writeTree(t, map[string]string{"broken.txt": "line one\n{{ .Name "})
+		err := scaffolder.Scaffold(src, t.TempDir(), nil)
+		var terr *scaffolder.TemplateError
+		assert.True(t, errors.As(err, &terr), "%v", err)
+		assert.Equal(t, filepath.Join(src, "broken.txt"), terr.Path)
+		assert.Equal(t, 2, terr.Line)
+	})
+	t.Run("FS", func(t *testing.T) {
+		err := scaffolder.Scaffold(filepath.Join(t.TempDir(), "missing"), t.TempDir(), nil)
+		var fserr *scaffolder.FSError
+		assert.True(t, errors.As(err, &fserr), "%v", err)
+		assert.Equal(t, "read directory", fserr.Op)
+		assert.True(t, errors.Is(err, fs.ErrNotExist))
+	})
+	t.Run("Exclude", func(t *testing.T) {
+		src := writeTree(t, map[string]string{"a.txt": ""})
+		err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Exclude("("))
+		var eerr *scaffolder.ExcludeError
+		assert.True(t, errors.As(err, &eerr), "%v", err)
+		assert.Equal(t, "(", eerr.Pattern)
+	})
+}
+
+func TestScaffoldFile(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"main.go.tmpl": "package {{ .Name }}\n",
+	})
+	dest := t.TempDir()
+	err := scaffolder.ScaffoldFile(filepath.Join(src, "main.go.tmpl"), filepath.Join(dest, "pkg", "main.go.tmpl"), map[string]any{"Name": "test"})
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "pkg/main.go", Mode: 0o600, Content: "package test\n"},
+	})
+}
+
+func TestScaffoldFileManifest(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"project/a.txt": "a",
+		"b.txt.tmpl":    "b {{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(filepath.Join(src, "project"), dest, nil, scaffolder.WriteManifest(".scaffolder.json"))
+	assert.NoError(t, err)
+	err = scaffolder.ScaffoldFile(filepath.Join(src, "b.txt.tmpl"), filepath.Join(dest, "b.txt"), map[string]any{"Name": "test"}, scaffolder.WriteManifest(".scaffolder.json"))
+	assert.NoError(t, err)
+
+	// Both the original files and the added one are cleaned up.
+	assert.NoError(t, scaffolder.Clean(filepath.Join(dest, ".scaffolder.json")))
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{})
+}
+
+func TestScaffoldFileRequireEmptyDest(t *testing.T) {
+	src := writeTree(t, map[string]string{"new.txt": "new"})
+	dest := writeTree(t, map[string]string{"existing.txt": "existing"})
+	err := scaffolder.ScaffoldFile(filepath.Join(src, "new.txt"), filepath.Join(dest, "new.txt"), nil, scaffolder.RequireEmptyDest())
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "existing.txt", Mode: 0o600, Content: "existing"},
+		{Name: "new.txt", Mode: 0o600, Content: "new"},
+	})
+
+	err = scaffolder.ScaffoldFile(filepath.Join(src, "new.txt"), filepath.Join(dest, "existing.txt"), nil, scaffolder.RequireEmptyDest())
+	assert.True(t, errors.Is(err, scaffolder.ErrDestNotEmpty), "%v", err)
+}
+
+func TestScaffoldFileScaffold(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"README.md":          `{{ scaffold "components/lib" . }}# {{ .Name }}`,
+		"components/lib/lib": "lib {{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.ScaffoldFile(filepath.Join(src, "README.md"), filepath.Join(dest, "README.md"), map[string]any{"Name": "test"})
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "README.md", Mode: 0o600, Content: "# test"},
+		{Name: "lib", Mode: 0o600, Content: "lib test"},
+	})
+}
+
+// countingExtension counts the files it sees and writes their number to a
+// manifest once scaffolding is complete.
+type countingExtension struct {
+	scaffolder.BaseExtension
+	files int
+}
+
+func (c *countingExtension) AfterEach(path string) error {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		c.files++
+	}
+	return nil
+}
+
+func (c *countingExtension) AfterAll(cfg *scaffolder.Config) error {
+	return cfg.AddFile("MANIFEST", []byte(fmt.Sprintf("%d files\n", c.files)), 0o600)
+}
+
+func TestAfterAllExtension(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"a.txt":     "",
+		"dir/b.txt": "",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Extend(&countingExtension{}))
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "MANIFEST", Mode: 0o600, Content: "2 files\n"},
+		{Name: "a.txt", Mode: 0o600},
+		{Name: "dir/b.txt", Mode: 0o600},
+	})
+}
+
+// prefixExtension prefixes the rendered content of every file.
+type prefixExtension struct {
+	scaffolder.BaseExtension
+	prefix string
+}
+
+func (p prefixExtension) WrapRender(next scaffolder.RenderFunc) scaffolder.RenderFunc {
+	return func(path, template string, ctx any) (string, error) {
+		content, err := next(path, template, ctx)
+		return p.prefix + content, err
+	}
+}
+
+func TestRenderExtension(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"{{ .Name }}.txt": "hello {{ .Name }}",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Name": "test"},
+		scaffolder.Extend(prefixExtension{prefix: "outer "}),
+		scaffolder.Extend(prefixExtension{prefix: "inner "}),
+	)
+	assert.NoError(t, err)
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "test.txt", Mode: 0o600, Content: "outer inner hello test"},
+	})
+}
+
+type panickingExtension struct{ scaffolder.BaseExtension }
+
+func (panickingExtension) WrapRender(next scaffolder.RenderFunc) scaffolder.RenderFunc {
+	return func(path, template string, ctx any) (string, error) { panic("wrapper failed") }
+}
+
+func TestPanicRecovery(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"file.txt": "{{ boom }}",
+	})
+	err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Functions(scaffolder.FuncMap{
+		"boom": func() string { panic("function failed") },
+	}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error calling boom: function failed")
+	var terr *scaffolder.TemplateError
+	assert.True(t, errors.As(err, &terr))
+	assert.Equal(t, filepath.Join(src, "file.txt"), terr.Path)
+
+	src = writeTree(t, map[string]string{
+		"file.txt": "content",
+	})
+	err = scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Extend(panickingExtension{}))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "panic while rendering: wrapper failed")
+	assert.True(t, errors.As(err, &terr))
+	assert.Equal(t, filepath.Join(src, "file.txt"), terr.Path)
+}
+
+func TestEmptyContentCreatesEmptyFile(t *testing.T) {
+	src := writeTree(t, map[string]string{
+		"dir/.gitkeep":  "",
+		"rendered.txt":  "{{ if .Include }}content{{ end }}",
+		"{{ .Empty }}x": "x",
+		"{{ .Empty }}":  "skipped",
+	})
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, map[string]any{"Include": false, "Empty": ""})
+	assert.NoError(t, err)
+	// The entry whose name renders empty is skipped, while the file whose
+	// content renders empty is still created.
+	scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+		{Name: "dir/.gitkeep", Mode: 0o600},
+		{Name: "rendered.txt", Mode: 0o600},
+		{Name: "x", Mode: 0o600, Content: "x"},
+	})
+	info, err := os.Stat(filepath.Join(dest, "rendered.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size())
+}
+
+// writeTree creates a template tree in a temporary directory from a map of
+// relative paths to file content.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	return dir
+}
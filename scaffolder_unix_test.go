@@ -0,0 +1,55 @@
+//go:build unix
+
+package scaffolder_test
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+)
+
+func TestForceMode(t *testing.T) {
+	src := writeTree(t, map[string]string{"shared.txt": "shared"})
+	assert.NoError(t, os.Chmod(filepath.Join(src, "shared.txt"), 0o666))
+	umask := syscall.Umask(0o077)
+	defer syscall.Umask(umask)
+
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil)
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dest, "shared.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	dest = t.TempDir()
+	err = scaffolder.Scaffold(src, dest, nil, scaffolder.ForceMode())
+	assert.NoError(t, err)
+	info, err = os.Stat(filepath.Join(dest, "shared.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o666), info.Mode().Perm())
+}
+
+func TestOwner(t *testing.T) {
+	src := writeTree(t, map[string]string{"dir/file.txt": "content"})
+	if os.Getuid() != 0 {
+		err := scaffolder.Scaffold(src, t.TempDir(), nil, scaffolder.Owner(0, 0))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "insufficient privileges")
+		t.Skip("changing ownership to another user requires root")
+	}
+
+	dest := t.TempDir()
+	err := scaffolder.Scaffold(src, dest, nil, scaffolder.Owner(1234, 5678))
+	assert.NoError(t, err)
+	for _, name := range []string{"dir", "dir/file.txt"} {
+		info, err := os.Lstat(filepath.Join(dest, name))
+		assert.NoError(t, err)
+		stat := info.Sys().(*syscall.Stat_t)
+		assert.Equal(t, [2]uint32{1234, 5678}, [2]uint32{stat.Uid, stat.Gid}, name)
+	}
+}
@@ -0,0 +1,103 @@
+package scaffolder
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const secretFuncName = "secret"
+
+// SecretProvider resolves the values of the "secret" template function, eg.
+// {{ secret "github-token" }}, so that secrets don't need to be passed in the
+// context.
+//
+// Resolved secret values are redacted from the messages of template errors,
+// including those from functions that were passed a secret, but are of course
+// written to any file that renders them. See EnvSecrets and FileSecrets for
+// simple providers.
+func SecretProvider(provider func(name string) (string, error)) Option {
+	return func(so *scaffoldOptions) {
+		so.Funcs[secretFuncName] = secretFunc(provider, so.secrets)
+	}
+}
+
+// EnvSecrets returns a SecretProvider that reads the secret name from the
+// environment variable prefix+name, eg. with the prefix "APP_" the secret
+// "TOKEN" is read from $APP_TOKEN.
+func EnvSecrets(prefix string) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		value, ok := os.LookupEnv(prefix + name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", prefix+name)
+		}
+		return value, nil
+	}
+}
+
+// FileSecrets returns a SecretProvider that reads the secret name from the
+// file of the same name in dir, with surrounding whitespace removed.
+func FileSecrets(dir string) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		if !filepath.IsLocal(name) {
+			return "", fmt.Errorf("%q is outside the secrets directory", name)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+}
+
+// secretFunc returns the "secret" function, which resolves secrets with
+// provider and records their values in secrets.
+func secretFunc(provider func(name string) (string, error), secrets *secretValues) func(name string) (string, error) {
+	return func(name string) (string, error) {
+		if provider == nil {
+			return "", fmt.Errorf("secret %q: no secret provider configured", name)
+		}
+		value, err := provider(name)
+		if err != nil {
+			return "", fmt.Errorf("secret %q: %w", name, err)
+		}
+		secrets.add(value)
+		return value, nil
+	}
+}
+
+// secretValues records the secret values resolved while scaffolding, so that
+// they can be redacted from errors.
+type secretValues struct {
+	values []string
+}
+
+func (v *secretValues) add(value string) {
+	if value != "" && !slices.Contains(v.values, value) {
+		v.values = append(v.values, value)
+	}
+}
+
+// redact returns err with any secret values in its message replaced, or err
+// itself if it contains none. The returned error still wraps err.
+func (v *secretValues) redact(err error) error {
+	msg := err.Error()
+	redacted := msg
+	for _, value := range v.values {
+		redacted = strings.ReplaceAll(redacted, value, "[redacted]")
+	}
+	if redacted == msg {
+		return err
+	}
+	return &redactedError{msg: redacted, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
@@ -0,0 +1,66 @@
+package scaffolder
+
+import "path/filepath"
+
+// SkipReason is why an entry in the source was not scaffolded, or was not
+// evaluated as a template. See OnSkip.
+type SkipReason string
+
+const (
+	// SkipExcludedByPattern entries match an Exclude, RootExclude or
+	// ExcludeTemplates pattern.
+	SkipExcludedByPattern SkipReason = "excluded-by-pattern"
+	// SkipExcludedByFunc entries are excluded by an ExcludeIf function.
+	SkipExcludedByFunc SkipReason = "excluded-by-func"
+	// SkipDotfile entries are dotfiles excluded by IncludeDotfiles(false).
+	SkipDotfile SkipReason = "dotfile"
+	// SkipMaxDepth entries are deeper than MaxDepth.
+	SkipMaxDepth SkipReason = "max-depth"
+	// SkipEmptyName entries have a name that evaluates to the empty string.
+	SkipEmptyName SkipReason = "empty-name"
+	// SkipPlatform entries have a platform suffix that doesn't match Platform.
+	SkipPlatform SkipReason = "platform"
+	// SkipUnchangedContent files are identical to the existing file and not
+	// rewritten, with SkipUnchanged.
+	SkipUnchangedContent SkipReason = "unchanged"
+	// SkipConflict files are not written because an existing file is kept, due
+	// to OverwriteOnly or OverwriteUnmodified.
+	SkipConflict SkipReason = "conflict-skip"
+	// SkipBinaryCopied files are detected as binary, and are copied verbatim
+	// rather than being evaluated as templates.
+	SkipBinaryCopied SkipReason = "binary-copied"
+)
+
+// Skip describes an entry reported by OnSkip.
+type Skip struct {
+	// Path is the path of the entry in the source, relative to the template
+	// root.
+	Path string
+	// Destination is the destination path of the entry, or empty if skipped
+	// before its name was evaluated.
+	Destination string
+	Reason      SkipReason
+}
+
+// OnSkip calls skip for each entry in the source that is not scaffolded, and
+// for each binary file copied without being evaluated, eg. to explain why a
+// file is missing from the output.
+//
+// Entries within a skipped directory are not reported.
+func OnSkip(skip func(Skip)) Option {
+	return func(so *scaffoldOptions) {
+		so.onSkip = append(so.onSkip, skip)
+	}
+}
+
+// skip reports the entry at srcPath, which would have been scaffolded to
+// dstPath, to the OnSkip hooks.
+func (s *state) skip(srcPath, dstPath string, reason SkipReason) {
+	if s.planning || len(s.onSkip) == 0 {
+		return
+	}
+	rel, _ := filepath.Rel(s.root, srcPath) // Can't fail.
+	for _, fn := range s.onSkip {
+		fn(Skip{Path: rel, Destination: dstPath, Reason: reason})
+	}
+}
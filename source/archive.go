@@ -0,0 +1,248 @@
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsURL reports whether src is an HTTP or HTTPS URL rather than a local path.
+func IsURL(src string) bool {
+	return strings.HasPrefix(src, "https://") || strings.HasPrefix(src, "http://")
+}
+
+// FetchArchive downloads the .tar.gz or .zip archive at url and extracts it
+// into a new temporary directory, returning the path of the template and a
+// function that removes the directory.
+//
+// If the archive contains a single top-level directory, as is common for
+// release archives, the path of that directory is returned. The archive format
+// is detected from its content. Entries that would be extracted outside the
+// directory, including via symlinks, are an error.
+func FetchArchive(ctx context.Context, url string, options ...Option) (string, func() error, error) {
+	conf := newConfig(options)
+	data, err := conf.fetch(ctx, url)
+	if err != nil {
+		return "", nil, err
+	}
+	if conf.sha256 != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != conf.sha256 {
+			return "", nil, fmt.Errorf("checksum mismatch for %s: expected sha256 %s but got %s", url, conf.sha256, actual)
+		}
+	}
+	dir, err := os.MkdirTemp("", "scaffolder-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(dir) }
+	switch {
+	case bytes.HasPrefix(data, []byte("\x1f\x8b")):
+		err = extractTarGz(dir, data)
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		err = extractZip(dir, data)
+	default:
+		err = errors.New("unsupported archive format, expected .tar.gz or .zip")
+	}
+	if err != nil {
+		_ = cleanup()
+		return "", nil, fmt.Errorf("failed to extract %s: %w", url, err)
+	}
+	root, err := archiveRoot(dir)
+	if err != nil {
+		_ = cleanup()
+		return "", nil, err
+	}
+	return root, cleanup, nil
+}
+
+// archiveRoot returns the single top-level directory in dir, if any, or dir.
+func archiveRoot(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		return filepath.Join(dir, entries[0].Name()), nil
+	}
+	return dir, nil
+}
+
+func extractTarGz(dir string, data []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	r := tar.NewReader(gz)
+	symlinks := [][2]string{}
+	for {
+		hdr, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return extractSymlinks(dir, symlinks)
+		} else if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = extractDir(dir, hdr.Name)
+		case tar.TypeReg:
+			err = extractFile(dir, hdr.Name, r, hdr.FileInfo().Mode())
+		case tar.TypeSymlink:
+			symlinks = append(symlinks, [2]string{hdr.Name, hdr.Linkname})
+		default:
+			// Other entry types, such as PAX headers, are ignored.
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(dir string, data []byte) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	symlinks := [][2]string{}
+	for _, f := range r.File {
+		if f.Mode()&fs.ModeSymlink != 0 {
+			target, err := readZipEntry(f)
+			if err != nil {
+				return err
+			}
+			symlinks = append(symlinks, [2]string{f.Name, string(target)})
+			continue
+		}
+		if err := extractZipEntry(dir, f); err != nil {
+			return err
+		}
+	}
+	return extractSymlinks(dir, symlinks)
+}
+
+func readZipEntry(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func extractZipEntry(dir string, f *zip.File) error {
+	if f.Mode().IsDir() {
+		return extractDir(dir, f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return extractFile(dir, f.Name, rc, f.Mode())
+}
+
+// extractSymlinks creates symlinks, given as name and target pairs, once all
+// other entries are extracted so that no entry is written through a symlink.
+func extractSymlinks(dir string, symlinks [][2]string) error {
+	for _, link := range symlinks {
+		if err := extractSymlink(dir, link[0], link[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryPath returns the path in dir of the archive entry name.
+func entryPath(dir, name string) (string, error) {
+	name = filepath.FromSlash(strings.TrimSuffix(name, "/"))
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("%s: entry is outside the archive", name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+func extractDir(dir, name string) error {
+	path, err := entryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(path, 0700)
+}
+
+func extractFile(dir, name string, r io.Reader, mode fs.FileMode) error {
+	path, err := entryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	w, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func extractSymlink(dir, name, target string) error {
+	path, err := entryPath(dir, name)
+	if err != nil {
+		return err
+	}
+	// Cleaning the target leaves ".." only as leading elements, so the lexical
+	// check below matches how the OS resolves it once no parent directory of
+	// the link is itself a symlink.
+	target = filepath.Clean(filepath.FromSlash(target))
+	if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(name)), target)) {
+		return fmt.Errorf("%s: symlink target %q is outside the archive", name, target)
+	}
+	if err := checkNoSymlinkParents(dir, path); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.Symlink(target, path)
+}
+
+// checkNoSymlinkParents returns an error if any existing parent directory of
+// path below dir is a symlink, as targets relative to it would not resolve
+// where the lexical check expects.
+func checkNoSymlinkParents(dir, path string) error {
+	rel, err := filepath.Rel(dir, filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return nil
+	}
+	parent := ""
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		parent = filepath.Join(parent, elem)
+		info, err := os.Lstat(filepath.Join(dir, parent))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("parent directory %q is a symlink", filepath.ToSlash(parent))
+		}
+	}
+	return nil
+}
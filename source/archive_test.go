@@ -0,0 +1,118 @@
+package source_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder"
+	"github.com/TBD54566975/scaffolder/scaffoldertest"
+	"github.com/TBD54566975/scaffolder/source"
+)
+
+func TestFetchArchive(t *testing.T) {
+	for name, archive := range map[string][]byte{
+		"tar.gz": tarGz(t, map[string]string{"template/{{ .Name }}.txt": "hello {{ .Name }}"}),
+		"zip":    zipFile(t, map[string]string{"template/{{ .Name }}.txt": "hello {{ .Name }}"}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := serve(t, archive)
+			sum := sha256.Sum256(archive)
+			dir, cleanup, err := source.FetchArchive(context.Background(), server.URL+"/template."+name, source.WithSHA256(hex.EncodeToString(sum[:])))
+			assert.NoError(t, err)
+
+			dest := t.TempDir()
+			err = scaffolder.Scaffold(dir, dest, map[string]any{"Name": "test"})
+			assert.NoError(t, err)
+			scaffoldertest.AssertFilesEqual(t, dest, []scaffoldertest.File{
+				{Name: "test.txt", Mode: 0o600, Content: "hello test"},
+			})
+
+			assert.NoError(t, cleanup())
+			_, err = os.Stat(dir)
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestFetchArchiveChecksumMismatch(t *testing.T) {
+	archive := tarGz(t, map[string]string{"file.txt": "content"})
+	server := serve(t, archive)
+	_, _, err := source.FetchArchive(context.Background(), server.URL, source.WithSHA256("0000"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestFetchArchiveRejectsTraversal(t *testing.T) {
+	archive := tarGz(t, map[string]string{"../escape.txt": "content"})
+	server := serve(t, archive)
+	_, _, err := source.FetchArchive(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "outside the archive")
+}
+
+func TestFetchArchiveRejectsSymlinkEscape(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	w := tar.NewWriter(gz)
+	assert.NoError(t, w.WriteHeader(&tar.Header{Name: "a/", Mode: 0o700, Typeflag: tar.TypeDir}))
+	assert.NoError(t, w.WriteHeader(&tar.Header{Name: "a/l1", Linkname: "..", Typeflag: tar.TypeSymlink}))
+	assert.NoError(t, w.WriteHeader(&tar.Header{Name: "a/l1/b/l3", Linkname: "../..", Typeflag: tar.TypeSymlink}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, gz.Close())
+	server := serve(t, buf.Bytes())
+	_, _, err := source.FetchArchive(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `parent directory "a/l1" is a symlink`)
+}
+
+func serve(t *testing.T, body []byte) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	w := tar.NewWriter(gz)
+	for name, content := range files {
+		assert.NoError(t, w.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := w.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func zipFile(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		hdr := &zip.FileHeader{Name: filepath.ToSlash(name), Method: zip.Deflate}
+		hdr.SetMode(0o600)
+		f, err := w.CreateHeader(hdr)
+		assert.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
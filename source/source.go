@@ -0,0 +1,105 @@
+// Package source fetches remote scaffolding templates.
+package source
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAttempts = 3
+	defaultBackoff  = time.Second
+)
+
+type config struct {
+	client   *http.Client
+	attempts int
+	backoff  time.Duration
+	sha256   string
+}
+
+// Option configures how a source is fetched.
+type Option func(*config)
+
+// WithRetry makes up to attempts attempts to fetch a source, waiting backoff
+// after the first failure and doubling the wait after each subsequent one.
+//
+// Network errors and 429 or 5xx responses are retried. The default is 3
+// attempts with a backoff of one second.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to fetch sources, which defaults to
+// http.DefaultClient.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) { c.client = client }
+}
+
+// WithSHA256 verifies that a fetched archive has the given hex-encoded SHA-256
+// checksum.
+func WithSHA256(sum string) Option {
+	return func(c *config) { c.sha256 = strings.ToLower(sum) }
+}
+
+func newConfig(options []Option) *config {
+	conf := &config{client: http.DefaultClient, attempts: defaultAttempts, backoff: defaultBackoff}
+	for _, option := range options {
+		option(conf)
+	}
+	return conf
+}
+
+// Fetch returns the body of the resource at url, retrying transient failures.
+func Fetch(ctx context.Context, url string, options ...Option) ([]byte, error) {
+	return newConfig(options).fetch(ctx, url)
+}
+
+func (c *config) fetch(ctx context.Context, url string) ([]byte, error) {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		body, retryable, err := c.get(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		if !retryable || attempt == c.attempts {
+			return nil, fmt.Errorf("failed to fetch %s after %d attempt(s): %w", url, attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to fetch %s after %d attempt(s): %w", url, attempt, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// get makes a single request for url, reporting whether a failure is worth
+// retrying.
+func (c *config) get(ctx context.Context, url string) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retryable, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	return body, false, nil
+}
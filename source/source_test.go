@@ -0,0 +1,57 @@
+package source_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/TBD54566975/scaffolder/source"
+)
+
+func TestFetchRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("template"))
+	}))
+	defer server.Close()
+
+	body, err := source.Fetch(context.Background(), server.URL, source.WithRetry(3, time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, "template", string(body))
+	assert.Equal(t, 3, requests)
+}
+
+func TestFetchRetriesExhausted(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := source.Fetch(context.Background(), server.URL, source.WithRetry(2, time.Millisecond))
+	assert.EqualError(t, err, "failed to fetch "+server.URL+" after 2 attempt(s): unexpected status 503 Service Unavailable")
+	assert.Equal(t, 2, requests)
+}
+
+func TestFetchDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	_, err := source.Fetch(context.Background(), server.URL, source.WithRetry(3, time.Millisecond))
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
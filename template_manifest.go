@@ -0,0 +1,133 @@
+package scaffolder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	remote "github.com/TBD54566975/scaffolder/source"
+)
+
+// templateManifest is the metadata file read from the root of each template
+// when TemplateManifest is used.
+type templateManifest struct {
+	// Extends is the parent template, either a path relative to the root of
+	// this template or the HTTP(S) URL of a template archive.
+	Extends string `yaml:"extends"`
+	// Modes maps glob patterns to octal file modes, applied as for
+	// ApplyModes, eg. {"scripts/*": "0755"}.
+	Modes map[string]string `yaml:"modes"`
+}
+
+// applyManifestModes adds the modes declared in the manifest at manifestPath
+// to those applied after writing, unless the pattern already has a mode from
+// ApplyModes or a child template.
+func (s *state) applyManifestModes(manifestPath string, manifest *templateManifest) error {
+	for pattern, value := range manifest.Modes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: invalid mode pattern %q: %w", manifestPath, pattern, err)
+		}
+		mode, err := strconv.ParseUint(strings.TrimPrefix(value, "0o"), 8, 32)
+		if err != nil || mode > uint64(fs.ModePerm) {
+			return fmt.Errorf("%s: invalid mode %q for %q, expected octal permissions such as 0755", manifestPath, value, pattern)
+		}
+		if s.modes == nil {
+			s.modes = map[string]fs.FileMode{}
+		}
+		if _, ok := s.modes[pattern]; !ok {
+			s.modes[pattern] = fs.FileMode(mode)
+		}
+	}
+	return nil
+}
+
+// readTemplateManifest reads the template manifest at path. A missing
+// manifest is empty.
+func readTemplateManifest(src source, path string) (*templateManifest, error) {
+	data, err := src.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &templateManifest{}, nil
+	} else if err != nil {
+		return nil, &FSError{Op: "read template manifest", Path: path, Err: err}
+	}
+	manifest := &templateManifest{}
+	if err := yaml.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("%s: invalid template manifest: %w", path, err)
+	}
+	return manifest, nil
+}
+
+// templateChain resolves the templates that source inherits from, returning
+// their roots in the order they are scaffolded, from the base template to
+// source itself.
+//
+// The returned cleanup function removes any fetched remote templates and
+// must be called once scaffolding is complete.
+func (s *state) templateChain(source string) (chain []string, cleanup func(), err error) {
+	var cleanups []func() error
+	cleanup = func() {
+		for _, fn := range cleanups {
+			_ = fn()
+		}
+	}
+	defer func() {
+		if err != nil {
+			cleanup()
+		}
+	}()
+	seen := map[string]bool{}
+	names := []string{}
+	dir, name := source, source
+	for {
+		key := name
+		if !remote.IsURL(name) {
+			if key, err = s.src.RealPath(dir); err != nil {
+				return nil, cleanup, &FSError{Op: "resolve template", Path: dir, Err: err}
+			}
+		}
+		names = append(names, name)
+		if seen[key] {
+			return nil, cleanup, fmt.Errorf("template inheritance cycle detected: %s", strings.Join(names, " -> "))
+		}
+		seen[key] = true
+		chain = append(chain, dir)
+		manifestPath := filepath.Join(dir, s.templateManifest)
+		s.templateManifests[manifestPath] = true
+		manifest, err := readTemplateManifest(s.src, manifestPath)
+		if err != nil {
+			return nil, cleanup, err
+		}
+		if err := s.applyManifestModes(manifestPath, manifest); err != nil {
+			return nil, cleanup, err
+		}
+		if manifest.Extends == "" {
+			break
+		}
+		name = manifest.Extends
+		switch {
+		case remote.IsURL(name):
+			if _, ok := s.src.(osFS); !ok {
+				return nil, cleanup, fmt.Errorf("%s: remote parent templates are only supported when scaffolding from disk", manifestPath)
+			}
+			fetched, remove, err := remote.FetchArchive(s.cancelCtx, name)
+			if err != nil {
+				return nil, cleanup, fmt.Errorf("%s: %w", manifestPath, err)
+			}
+			cleanups = append(cleanups, remove)
+			dir = fetched
+		case filepath.IsAbs(name):
+			dir = name
+		default:
+			dir = filepath.Join(dir, filepath.FromSlash(name))
+		}
+	}
+	slices.Reverse(chain)
+	return chain, cleanup, nil
+}
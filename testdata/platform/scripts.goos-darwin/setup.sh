@@ -0,0 +1 @@
+darwin
\ No newline at end of file
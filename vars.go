@@ -0,0 +1,146 @@
+package scaffolder
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/template"
+	"text/template/parse"
+)
+
+// ReferencedVars returns the sorted names of the top-level context fields
+// referenced by path names, symlink targets and file contents in source, eg.
+// "Name" for a template containing {{ .Name }}.
+//
+// Fields are collected wherever dot is known to be the root context, or
+// where they are accessed via $. Fields accessed within range and with blocks
+// are not top-level and are ignored. Templates scaffolded with a subcontext
+// via push are analysed as if they received the root context.
+//
+// As with Scaffold, the contents of binary files and of files rendered by a
+// renderer are not Go templates and are ignored, as are any templates
+// evaluated with an Engine other than text/template.
+func ReferencedVars(source string, options ...Option) ([]string, error) {
+	opts, err := newOptions(osFS{}, source, "", nil, options)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]bool{}
+	err = WalkDir(source, func(path string, d fs.DirEntry) error {
+		if path == source {
+			return nil
+		}
+		relPath, _ := filepath.Rel(source, path) // Can't fail.
+		if excluded, err := opts.excluded(relPath); err != nil {
+			return err
+		} else if excluded {
+			return ErrSkip
+		}
+		if err := collectTemplateVars(opts.engine, path, d.Name(), opts.Funcs, vars); err != nil {
+			return err
+		}
+		var content string
+		switch {
+		case d.Type()&fs.ModeSymlink != 0:
+			if content, err = os.Readlink(path); err != nil {
+				return &FSError{Op: "read symlink", Path: path, Err: err}
+			}
+		case d.Type().IsRegular():
+			if render, _ := opts.renderer(path); render != nil {
+				return nil
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return &FSError{Op: "read file", Path: path, Err: err}
+			}
+			if opts.isBinary(relPath, data[:min(len(data), binaryHeadSize)]) {
+				return nil
+			}
+			content = string(data)
+		default:
+			return nil
+		}
+		return collectTemplateVars(opts.engine, path, content, opts.Funcs, vars)
+	})
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// collectTemplateVars records the top-level fields referenced by tmpl, if
+// engine parses it as a text/template.
+func collectTemplateVars(engine Engine, path, tmpl string, funcs template.FuncMap, vars map[string]bool) error {
+	parsed, err := engine.Parse(path, tmpl, funcs)
+	if err != nil {
+		return &TemplateError{Path: path, Line: templateErrorLine(path, err), Err: fmt.Errorf("failed to parse template: %w", err)}
+	}
+	t, ok := parsed.(*template.Template)
+	if !ok {
+		return nil
+	}
+	for _, t := range t.Templates() {
+		if t.Tree != nil {
+			collectNodeVars(t.Tree.Root, true, vars)
+		}
+	}
+	return nil
+}
+
+// collectNodeVars records top-level field references in node. rootDot is true
+// if dot refers to the root context.
+func collectNodeVars(node parse.Node, rootDot bool, vars map[string]bool) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			collectNodeVars(child, rootDot, vars)
+		}
+	case *parse.ActionNode:
+		collectNodeVars(node.Pipe, rootDot, vars)
+	case *parse.PipeNode:
+		if node == nil {
+			return
+		}
+		for _, cmd := range node.Cmds {
+			collectNodeVars(cmd, rootDot, vars)
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			collectNodeVars(arg, rootDot, vars)
+		}
+	case *parse.ChainNode:
+		collectNodeVars(node.Node, rootDot, vars)
+	case *parse.FieldNode:
+		if rootDot {
+			vars[node.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if node.Ident[0] == "$" && len(node.Ident) > 1 {
+			vars[node.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		collectNodeVars(node.Pipe, rootDot, vars)
+		collectNodeVars(node.List, rootDot, vars)
+		collectNodeVars(node.ElseList, rootDot, vars)
+	case *parse.RangeNode:
+		collectNodeVars(node.Pipe, rootDot, vars)
+		collectNodeVars(node.List, false, vars)
+		collectNodeVars(node.ElseList, rootDot, vars)
+	case *parse.WithNode:
+		collectNodeVars(node.Pipe, rootDot, vars)
+		collectNodeVars(node.List, false, vars)
+		collectNodeVars(node.ElseList, rootDot, vars)
+	case *parse.TemplateNode:
+		collectNodeVars(node.Pipe, rootDot, vars)
+	}
+}
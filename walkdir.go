@@ -10,11 +10,41 @@ import (
 // ErrSkip can be returned by WalkDir callbacks to skip a file or directory.
 var ErrSkip = errors.New("skip directory")
 
+type walkOptions struct {
+	onReadDirError func(path string, err error)
+}
+
+// WalkOption configures WalkDir.
+type WalkOption func(*walkOptions)
+
+// SkipUnreadableDirs makes WalkDir skip the contents of directories that can't
+// be read due to insufficient permissions, rather than failing the walk. Other
+// errors reading a directory still fail the walk.
+//
+// report is called with the path of each skipped directory and the error
+// reading it, and may be nil.
+func SkipUnreadableDirs(report func(path string, err error)) WalkOption {
+	return func(o *walkOptions) {
+		if report == nil {
+			report = func(string, error) {}
+		}
+		o.onReadDirError = report
+	}
+}
+
 // WalkDir performs a depth-first walk of dir, executing fn before each file or
 // directory.
 //
 // If fn returns ErrSkip, the directory will be skipped.
-func WalkDir(dir string, fn func(path string, d fs.DirEntry) error) error {
+func WalkDir(dir string, fn func(path string, d fs.DirEntry) error, options ...WalkOption) error {
+	opts := &walkOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+	return walkDir(dir, fn, opts)
+}
+
+func walkDir(dir string, fn func(path string, d fs.DirEntry) error, opts *walkOptions) error {
 	dirInfo, err := os.Stat(dir)
 	if err != nil {
 		return err
@@ -27,11 +57,15 @@ func WalkDir(dir string, fn func(path string, d fs.DirEntry) error) error {
 	}
 	entries, err := os.ReadDir(dir)
 	if err != nil {
+		if opts.onReadDirError != nil && errors.Is(err, fs.ErrPermission) {
+			opts.onReadDirError(dir, err)
+			return nil
+		}
 		return err
 	}
 	for _, entry := range entries {
 		if entry.IsDir() {
-			err = WalkDir(filepath.Join(dir, entry.Name()), fn)
+			err = walkDir(filepath.Join(dir, entry.Name()), fn, opts)
 			if err != nil && !errors.Is(err, ErrSkip) {
 				return err
 			}